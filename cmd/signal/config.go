@@ -1,17 +1,156 @@
 package main
 
-import "github.com/spf13/viper"
+import (
+	"time"
+
+	"github.com/spf13/viper"
+)
 
 type Config struct {
-	Logger          loggerConf
-	Port            int
-	MediaServerHost string
+	Logger            loggerConf
+	Port              int
+	MediaServerHost   string
+	MediaServer       mediaServerConf
+	MediaServers      []mediaServerConf
+	MediaServerHealth mediaServerHealthConf
+	RoomStore         roomStoreConf
+	Auth              authConf
+	ResumeGracePeriod time.Duration
+	Admin             adminConf
+	Webhooks          webhooksConf
+	ICE               iceConf
+	SendQueue         sendQueueConf
+	Speakers          speakersConf
+	Rooms             roomsConf
+	Push              pushConf
+	CallHistory       callHistoryConf
+	Chat              chatConf
+	Custom            customConf
+	Reactions         reactionsConf
 }
 
 type loggerConf struct {
 	Level string
 }
 
+type mediaServerConf struct {
+	Name      string
+	Type      string
+	Host      string
+	Weight    int
+	HealthURL string
+	WHIP      whipConf
+}
+
+type mediaServerHealthConf struct {
+	Interval time.Duration
+}
+
+type whipConf struct {
+	PublishURL string
+	PlayURL    string
+	Token      string
+}
+
+type roomsConf struct {
+	MaxParticipants int
+	MaxScreenShares int
+	RingTimeout     time.Duration
+}
+
+type pushConf struct {
+	FCM  fcmConf
+	APNs apnsConf
+	// Fake records the pushes instead of sending them.
+	Fake bool
+}
+
+type fcmConf struct {
+	ProjectID       string
+	CredentialsFile string
+}
+
+type apnsConf struct {
+	KeyFile string
+	KeyID   string
+	TeamID  string
+	Topic   string
+	Sandbox bool
+}
+
+type chatConf struct {
+	HistorySize int
+	MaxLength   int
+	Rate        int
+	RateWindow  time.Duration
+}
+
+type reactionsConf struct {
+	Rate       int
+	RateWindow time.Duration
+}
+
+type customConf struct {
+	// Types lists the custom events relayed, the others are refused.
+	Types          []string
+	MaxPayloadSize int
+}
+
+type callHistoryConf struct {
+	// Type is memory or file, empty disables the call history.
+	Type string
+	Path string
+}
+
+type speakersConf struct {
+	Window         time.Duration
+	Threshold      float64
+	Ratio          float64
+	Hold           time.Duration
+	LevelsInterval time.Duration
+}
+
+type sendQueueConf struct {
+	Size       int
+	EvictAfter time.Duration
+}
+
+type iceConf struct {
+	STUNURLs []string
+	TURNURLs []string
+	Secret   string
+	TTL      time.Duration
+}
+
+type webhooksConf struct {
+	URLs        []string
+	Secret      string
+	QueueSize   int
+	MaxAttempts int
+	Backoff     time.Duration
+	Timeout     time.Duration
+}
+
+type adminConf struct {
+	Token string
+}
+
+type authConf struct {
+	HMACSecret   string
+	RSAPublicKey string
+}
+
+type roomStoreConf struct {
+	Type  string
+	Redis redisConf
+}
+
+type redisConf struct {
+	Addr     string
+	Password string
+	DB       int
+}
+
 func LoadConfig(path string) (Config, error) {
 	config := Config{}
 
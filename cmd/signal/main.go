@@ -9,9 +9,13 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/redis/go-redis/v9"
 	internalapp "signal/internal/app"
 	internallogger "signal/internal/logger"
+	"signal/internal/metrics"
+	internalrooms "signal/internal/rooms"
 	internalhttp "signal/internal/server/http"
+	"signal/internal/webhooks"
 )
 
 var configFile string
@@ -35,7 +39,106 @@ func main() {
 
 	logg := internallogger.New(config.Logger.Level, nil)
 
-	server := internalhttp.New(logg, internalapp.New(logg, config.MediaServerHost), "", config.Port)
+	store, pushTokens, err := newStores(ctx, config.RoomStore)
+	if err != nil {
+		logg.Error("failed to create room store: " + err.Error())
+		cancel()
+		os.Exit(1) //nolint:gocritic
+	}
+
+	pushProviders, err := newPushProviders(config.Push)
+	if err != nil {
+		logg.Error("failed to create push providers: " + err.Error())
+		cancel()
+		os.Exit(1)
+	}
+
+	mediaServers, err := newMediaServerPool(config)
+	if err != nil {
+		logg.Error("failed to create media servers: " + err.Error())
+		cancel()
+		os.Exit(1)
+	}
+	if config.MediaServerHealth.Interval > 0 {
+		go mediaServers.Run(ctx, config.MediaServerHealth.Interval)
+	}
+
+	appMetrics := metrics.New()
+
+	opts := []internalapp.Option{
+		internalapp.WithRoomStore(store),
+		internalapp.WithMediaServerPool(mediaServers),
+		internalapp.WithMetrics(appMetrics),
+		internalapp.WithResumeGracePeriod(config.ResumeGracePeriod),
+		internalapp.WithMaxParticipants(config.Rooms.MaxParticipants),
+		internalapp.WithMaxScreenShares(config.Rooms.MaxScreenShares),
+		internalapp.WithRingTimeout(config.Rooms.RingTimeout),
+		internalapp.WithPusher(internalapp.NewPusher(pushTokens, pushProviders)),
+		internalapp.WithSendQueue(config.SendQueue.Size, config.SendQueue.EvictAfter),
+		internalapp.WithSpeakerDetection(internalrooms.SpeakerConfig{
+			Window:         config.Speakers.Window,
+			Threshold:      config.Speakers.Threshold,
+			Ratio:          config.Speakers.Ratio,
+			Hold:           config.Speakers.Hold,
+			LevelsInterval: config.Speakers.LevelsInterval,
+		}),
+		internalapp.WithChat(internalrooms.ChatConfig{
+			HistorySize: config.Chat.HistorySize,
+			MaxLength:   config.Chat.MaxLength,
+			Rate:        config.Chat.Rate,
+			RateWindow:  config.Chat.RateWindow,
+		}),
+		internalapp.WithReactions(internalrooms.ReactionConfig{
+			Rate:       config.Reactions.Rate,
+			RateWindow: config.Reactions.RateWindow,
+		}),
+		internalapp.WithCustomEvents(config.Custom.Types, config.Custom.MaxPayloadSize),
+		internalapp.WithICEServers(internalapp.NewICEServers(internalapp.ICEConfig{
+			STUNURLs: config.ICE.STUNURLs,
+			TURNURLs: config.ICE.TURNURLs,
+			Secret:   config.ICE.Secret,
+			TTL:      config.ICE.TTL,
+		})),
+	}
+
+	if config.Auth.HMACSecret != "" || config.Auth.RSAPublicKey != "" {
+		verifier, err := internalapp.NewJWTVerifier(config.Auth.HMACSecret, config.Auth.RSAPublicKey)
+		if err != nil {
+			logg.Error("failed to create token verifier: " + err.Error())
+			cancel()
+			os.Exit(1)
+		}
+		opts = append(opts, internalapp.WithTokenVerifier(verifier))
+	} else {
+		logg.Warn("token verification is disabled, rooms trust the first client token")
+	}
+
+	if len(config.Webhooks.URLs) > 0 {
+		dispatcher := webhooks.New(webhooks.Config{
+			URLs:        config.Webhooks.URLs,
+			Secret:      config.Webhooks.Secret,
+			QueueSize:   config.Webhooks.QueueSize,
+			MaxAttempts: config.Webhooks.MaxAttempts,
+			Backoff:     config.Webhooks.Backoff,
+			Timeout:     config.Webhooks.Timeout,
+		})
+		go dispatcher.Run(ctx)
+		opts = append(opts, internalapp.WithWebhooks(dispatcher))
+	}
+
+	callHistory, err := newCallHistoryStore(config.CallHistory)
+	if err != nil {
+		logg.Error("failed to create call history: " + err.Error())
+		cancel()
+		os.Exit(1)
+	}
+	if callHistory != nil {
+		opts = append(opts, internalapp.WithCallHistory(callHistory))
+	}
+
+	app := internalapp.New(logg, config.MediaServerHost, opts...)
+
+	server := internalhttp.New(logg, app, appMetrics.Handler(), config.Admin.Token, "", config.Port)
 
 	go func() {
 		<-ctx.Done()
@@ -56,3 +159,132 @@ func main() {
 		os.Exit(1) //nolint:gocritic
 	}
 }
+
+// newStores returns the room store and the push token store, both shared
+// through Redis or local to the instance.
+func newStores(
+	ctx context.Context,
+	config roomStoreConf,
+) (internalapp.RoomStore, internalapp.PushTokenStore, error) {
+	switch config.Type {
+	case "", "memory":
+		return internalapp.NewMemoryRoomStore(), internalapp.NewMemoryPushTokenStore(), nil
+	case "redis":
+		client := redis.NewClient(&redis.Options{
+			Addr:     config.Redis.Addr,
+			Password: config.Redis.Password,
+			DB:       config.Redis.DB,
+		})
+		store, err := internalapp.NewRedisRoomStore(ctx, client)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, internalapp.NewRedisPushTokenStore(client), nil
+	default:
+		return nil, nil, fmt.Errorf("unknown room store type %q", config.Type)
+	}
+}
+
+// newCallHistoryStore returns the store of the call detail records, nil if
+// they are not recorded.
+func newCallHistoryStore(config callHistoryConf) (internalapp.CallHistoryStore, error) {
+	switch config.Type {
+	case "":
+		return nil, nil
+	case "memory":
+		return internalapp.NewMemoryCallHistoryStore(), nil
+	case "file":
+		return internalapp.NewFileCallHistoryStore(config.Path)
+	default:
+		return nil, fmt.Errorf("unknown call history type %q", config.Type)
+	}
+}
+
+// newPushProviders returns the providers configured by platform.
+func newPushProviders(config pushConf) (map[string]internalapp.PushProvider, error) {
+	providers := map[string]internalapp.PushProvider{}
+
+	if config.Fake {
+		fake := internalapp.NewFakePushProvider()
+		providers[internalapp.FCMPlatform] = fake
+		providers[internalapp.APNsPlatform] = fake
+		return providers, nil
+	}
+
+	if config.FCM.ProjectID != "" {
+		fcm, err := internalapp.NewFCMPushProvider(internalapp.FCMConfig{
+			ProjectID:       config.FCM.ProjectID,
+			CredentialsFile: config.FCM.CredentialsFile,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("fcm: %w", err)
+		}
+		providers[internalapp.FCMPlatform] = fcm
+	}
+
+	if config.APNs.KeyFile != "" {
+		apns, err := internalapp.NewAPNsPushProvider(internalapp.APNsConfig{
+			KeyFile: config.APNs.KeyFile,
+			KeyID:   config.APNs.KeyID,
+			TeamID:  config.APNs.TeamID,
+			Topic:   config.APNs.Topic,
+			Sandbox: config.APNs.Sandbox,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("apns: %w", err)
+		}
+		providers[internalapp.APNsPlatform] = apns
+	}
+
+	return providers, nil
+}
+
+// newMediaServerPool builds the pool of config.MediaServers, a single
+// config.MediaServer on config.MediaServerHost without it.
+func newMediaServerPool(config Config) (*internalapp.MediaServerPool, error) {
+	servers := config.MediaServers
+	if len(servers) == 0 {
+		servers = []mediaServerConf{config.MediaServer}
+	}
+
+	nodes := make([]internalapp.MediaServerNode, 0, len(servers))
+	for _, server := range servers {
+		if server.Host == "" {
+			server.Host = config.MediaServerHost
+		}
+		if server.Name == "" {
+			server.Name = server.Host
+		}
+
+		mediaServer, err := newMediaServer(server)
+		if err != nil {
+			return nil, fmt.Errorf("media server %q: %w", server.Name, err)
+		}
+
+		nodes = append(nodes, internalapp.MediaServerNode{
+			Name:      server.Name,
+			Server:    mediaServer,
+			Weight:    server.Weight,
+			HealthURL: server.HealthURL,
+		})
+	}
+
+	return internalapp.NewMediaServerPool(nodes...)
+}
+
+func newMediaServer(config mediaServerConf) (internalapp.MediaServer, error) {
+	switch config.Type {
+	case "", "srs":
+		return internalapp.NewSRSMediaServer(config.Host), nil
+	case "whip":
+		return internalapp.NewWHIPMediaServer(internalapp.WHIPConfig{
+			PublishURL: config.WHIP.PublishURL,
+			PlayURL:    config.WHIP.PlayURL,
+			Token:      config.WHIP.Token,
+		})
+	case "fake":
+		return internalapp.NewFakeMediaServer(), nil
+	default:
+		return nil, fmt.Errorf("unknown media server type %q", config.Type)
+	}
+}
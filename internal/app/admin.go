@@ -0,0 +1,142 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/ossrs/go-oryx-lib/errors"
+	"github.com/ossrs/go-oryx-lib/logger"
+	internalrooms "signal/internal/rooms"
+	"signal/internal/webhooks"
+)
+
+// AdminRooms lists the rooms served by this instance.
+func (a *App) AdminRooms(ctx context.Context) ([]byte, error) {
+	rooms := make([]AdminRoomSummary, 0)
+
+	a.rooms.Range(ctx, func(r *internalrooms.Room) bool {
+		snapshot := r.Snapshot()
+
+		rooms = append(rooms, AdminRoomSummary{
+			Name:                snapshot.Name,
+			Type:                snapshot.Type,
+			Participants:        len(snapshot.Participants),
+			InvitedParticipants: len(snapshot.InvitedParticipants),
+			Devices:             len(snapshot.Devices),
+			StartedAt:           snapshot.StartedAt,
+		})
+
+		return true
+	})
+
+	sort.Slice(rooms, func(i, j int) bool {
+		return rooms[i].Name < rooms[j].Name
+	})
+
+	body, err := json.Marshal(rooms)
+	if err != nil {
+		return nil, errors.Wrapf(err, "marshal")
+	}
+
+	return body, nil
+}
+
+// AdminRoom returns the full state of a room, found is false if it does not exist.
+func (a *App) AdminRoom(ctx context.Context, name string) (body []byte, found bool, err error) {
+	r, loaded := a.rooms.LoadShared(ctx, name)
+	if !loaded {
+		return nil, false, nil
+	}
+
+	body, err = json.Marshal(r.Snapshot())
+	if err != nil {
+		return nil, true, errors.Wrapf(err, "marshal")
+	}
+
+	return body, true, nil
+}
+
+// AdminKick disconnects a participant, peers are notified with leave.
+func (a *App) AdminKick(ctx context.Context, room string, userID int64) bool {
+	r, loaded := a.rooms.LoadShared(ctx, room)
+	if !loaded {
+		return false
+	}
+
+	if !r.Kick(ctx, userID) {
+		return false
+	}
+
+	logger.Tf(ctx, "Admin kick %d from %v", userID, r)
+
+	return true
+}
+
+// AdminCloseRoom ends the call for everyone in the room.
+func (a *App) AdminCloseRoom(ctx context.Context, room string) bool {
+	r, loaded := a.rooms.LoadShared(ctx, room)
+	if !loaded {
+		return false
+	}
+
+	logger.Tf(ctx, "Admin close %v", r)
+
+	go func() {
+		r.End(context.Background(), 0, internalrooms.ClosedReason)
+		// Rooms with ringing devices only have nobody to report them empty.
+		a.emptyRooms <- r.Name
+	}()
+
+	return true
+}
+
+// AdminWebhookDeliveries returns the recent webhook delivery attempts.
+func (a *App) AdminWebhookDeliveries(_ context.Context) ([]byte, error) {
+	deliveries := make([]webhooks.Delivery, 0)
+	if a.webhooks != nil {
+		deliveries = append(deliveries, a.webhooks.Deliveries()...)
+	}
+
+	body, err := json.Marshal(deliveries)
+	if err != nil {
+		return nil, errors.Wrapf(err, "marshal")
+	}
+
+	return body, nil
+}
+
+// AdminCallHistory returns the recorded calls of the user created in
+// [from, to), newest first, as JSON or as CSV when format is "csv".
+func (a *App) AdminCallHistory(
+	ctx context.Context,
+	userID int64,
+	from, to time.Time,
+	limit int,
+	format string,
+) ([]byte, error) {
+	records := make([]CallRecord, 0)
+	if a.callHistory != nil {
+		var err error
+		records, err = a.callHistory.Query(ctx, CallHistoryQuery{UserID: userID, From: from, To: to, Limit: limit})
+		if err != nil {
+			return nil, errors.Wrapf(err, "query call history")
+		}
+	}
+
+	if format == "csv" {
+		body, err := MarshalCallRecordsCSV(records)
+		if err != nil {
+			return nil, errors.Wrapf(err, "marshal")
+		}
+		return body, nil
+	}
+
+	body, err := json.Marshal(records)
+	if err != nil {
+		return nil, errors.Wrapf(err, "marshal")
+	}
+
+	return body, nil
+}
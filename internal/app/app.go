@@ -3,19 +3,53 @@ package app
 import (
 	"context"
 	"encoding/json"
-	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/ossrs/go-oryx-lib/errors"
 	"github.com/ossrs/go-oryx-lib/logger"
+	"signal/internal/metrics"
+	internalrooms "signal/internal/rooms"
+	"signal/internal/webhooks"
 )
 
 type App struct {
-	logger          Logger
-	rooms           sync.Map // todo: тут не нужно типизировать?
-	emptyRooms      chan string
-	mediaServerHost string
+	logger       Logger
+	rooms        RoomStore
+	verifier     TokenVerifier
+	resumeGrace  time.Duration
+	emptyRooms   chan string
+	mediaServers *MediaServerPool
+	metrics      *metrics.Metrics
+	observers    observers
+	webhooks     *webhooks.Dispatcher
+	iceServers   *ICEServers
+	pusher       *Pusher
+	callHistory  CallHistoryStore
+	sendQueue    internalrooms.QueueConfig
+	speakers     internalrooms.SpeakerConfig
+	chat         internalrooms.ChatConfig
+	reactions    internalrooms.ReactionConfig
+	// customTypes are the custom events relayed, at most
+	// maxCustomPayload bytes each.
+	customTypes      map[string]bool
+	maxCustomPayload int
+	// maxParticipants bounds group rooms, 0 means unlimited.
+	maxParticipants int
+	// maxScreenShares bounds the screens shared at once in a room, 0
+	// means unlimited.
+	maxScreenShares int
+	// ringTimeout expires unanswered invitations, 0 means never.
+	ringTimeout time.Duration
+}
+
+// observers fans the room events out to every registered observer.
+type observers []internalrooms.Observer
+
+func (o observers) Observe(ctx context.Context, e internalrooms.Event) {
+	for _, observer := range o {
+		observer.Observe(ctx, e)
+	}
 }
 
 type Logger interface {
@@ -25,6 +59,8 @@ type Logger interface {
 	Error(msg string)
 }
 
+type Option func(a *App)
+
 var handlers map[string]ActionHandler
 
 const (
@@ -40,24 +76,206 @@ const (
 
 func init() {
 	handlers = map[string]ActionHandler{
-		"accept":        handleAccept,
-		"decline":       handleDecline,
-		"busy":          handleBusy,
-		"publish":       handlePublish,
-		"streamPublish": handleStreamPublish,
-		"streamPlay":    handleStreamPlay,
-		"ready":         handleReady,
-		"changeState":   handleChangeState,
-		"speak":         handleSpeak,
-		"inviteUsers":   handleInviteUsers,
+		"accept":                             handleAccept,
+		"decline":                            handleDecline,
+		"busy":                               handleBusy,
+		"publish":                            handlePublish,
+		"unpublish":                          handleUnpublish,
+		"streamPublish":                      handleStreamPublish,
+		"streamPlay":                         handleStreamPlay,
+		"ready":                              handleReady,
+		"changeState":                        handleChangeState,
+		"speak":                              handleSpeak,
+		"inviteUsers":                        handleInviteUsers,
+		"cancelInvite":                       handleCancelInvite,
+		"registerPushToken":                  handleRegisterPushToken,
+		"leave":                              handleLeave,
+		"hangup":                             handleHangup,
+		"endCall":                            handleHangup,
+		"offer":                              handleRelay,
+		"answer":                             handleRelay,
+		"iceCandidate":                       handleRelay,
+		"iceServers":                         handleICEServers,
+		internalrooms.ChatEvent:              handleChat,
+		internalrooms.ChatAckEvent:           handleChatAck,
+		internalrooms.CustomEvent:            handleCustom,
+		internalrooms.RaiseHandEvent:         handleHand,
+		internalrooms.LowerHandEvent:         handleHand,
+		internalrooms.LowerAllHandsEvent:     handleHand,
+		internalrooms.ReactionEvent:          handleReaction,
+		internalrooms.MuteParticipantEvent:   handleModerate,
+		internalrooms.DisableCameraEvent:     handleModerate,
+		internalrooms.RemoveParticipantEvent: handleModerate,
+		internalrooms.MuteAllEvent:           handleModerate,
+		internalrooms.LockRoomEvent:          handleModerate,
+		internalrooms.UnlockRoomEvent:        handleModerate,
+	}
+}
+
+// WithRoomStore replaces the default in-memory room store.
+func WithRoomStore(store RoomStore) Option {
+	return func(a *App) {
+		a.rooms = store
+	}
+}
+
+// WithTokenVerifier requires signed tokens on preconnect and join.
+func WithTokenVerifier(verifier TokenVerifier) Option {
+	return func(a *App) {
+		a.verifier = verifier
+	}
+}
+
+// WithResumeGracePeriod keeps participants whose connection dropped in the
+// room for the given period so they can resume.
+func WithResumeGracePeriod(grace time.Duration) Option {
+	return func(a *App) {
+		a.resumeGrace = grace
+	}
+}
+
+// WithMetrics records the instance metrics into m.
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(a *App) {
+		a.metrics = m
 	}
 }
 
-func New(logger Logger, mediaServerHost string) *App {
+// WithObserver registers an observer of the room events of this instance.
+func WithObserver(observer internalrooms.Observer) Option {
+	return func(a *App) {
+		a.observers = append(a.observers, observer)
+	}
+}
+
+// WithWebhooks posts the room lifecycle events through the dispatcher.
+func WithWebhooks(dispatcher *webhooks.Dispatcher) Option {
+	return func(a *App) {
+		a.webhooks = dispatcher
+		a.observers = append(a.observers, dispatcher)
+	}
+}
+
+// WithCallHistory records the calls of this instance into store.
+func WithCallHistory(store CallHistoryStore) Option {
+	return func(a *App) {
+		a.callHistory = store
+		a.observers = append(a.observers, NewCallRecorder(store))
+	}
+}
+
+// WithMediaServer replaces the SRS media server of mediaServerHost.
+func WithMediaServer(name string, mediaServer MediaServer) Option {
+	return func(a *App) {
+		a.mediaServers = newSingleMediaServerPool(name, mediaServer)
+	}
+}
+
+// WithMediaServerPool spreads the rooms over the media servers of pool.
+func WithMediaServerPool(pool *MediaServerPool) Option {
+	return func(a *App) {
+		a.mediaServers = pool
+	}
+}
+
+// WithICEServers hands out the STUN and TURN servers on join.
+func WithICEServers(iceServers *ICEServers) Option {
+	return func(a *App) {
+		a.iceServers = iceServers
+	}
+}
+
+// WithPusher rings the invited users through push notifications.
+func WithPusher(pusher *Pusher) Option {
+	return func(a *App) {
+		a.pusher = pusher
+	}
+}
+
+// WithSendQueue bounds the messages queued for every connection, a
+// connection whose queue stays full for evictAfter is closed.
+func WithSendQueue(size int, evictAfter time.Duration) Option {
+	return func(a *App) {
+		a.sendQueue.Size = size
+		a.sendQueue.EvictAfter = evictAfter
+	}
+}
+
+// WithSpeakerDetection tunes the active speaker detection of the rooms.
+func WithSpeakerDetection(config internalrooms.SpeakerConfig) Option {
+	return func(a *App) {
+		a.speakers = config
+	}
+}
+
+// WithChat bounds the chat history, message length and rate of the rooms.
+func WithChat(config internalrooms.ChatConfig) Option {
+	return func(a *App) {
+		a.chat = config
+	}
+}
+
+// WithReactions limits the reactions of every participant.
+func WithReactions(config internalrooms.ReactionConfig) Option {
+	return func(a *App) {
+		a.reactions = config
+	}
+}
+
+// WithCustomEvents relays the custom events of the types, without them
+// every custom event is refused. A payload over maxPayloadSize bytes is
+// refused too.
+func WithCustomEvents(types []string, maxPayloadSize int) Option {
+	return func(a *App) {
+		a.customTypes = map[string]bool{}
+		for _, customType := range types {
+			a.customTypes[customType] = true
+		}
+		a.maxCustomPayload = maxPayloadSize
+	}
+}
+
+// WithMaxParticipants bounds the participants of group rooms.
+func WithMaxParticipants(maxParticipants int) Option {
+	return func(a *App) {
+		a.maxParticipants = maxParticipants
+	}
+}
+
+// WithMaxScreenShares bounds the screens shared at once in a room.
+func WithMaxScreenShares(maxScreenShares int) Option {
+	return func(a *App) {
+		a.maxScreenShares = maxScreenShares
+	}
+}
+
+// WithRingTimeout expires the invitations nobody answered.
+func WithRingTimeout(ringTimeout time.Duration) Option {
+	return func(a *App) {
+		a.ringTimeout = ringTimeout
+	}
+}
+
+func New(logger Logger, mediaServerHost string, opts ...Option) *App {
 	a := &App{
-		logger:          logger,
-		emptyRooms:      make(chan string),
-		mediaServerHost: mediaServerHost,
+		logger:       logger,
+		rooms:        NewMemoryRoomStore(),
+		emptyRooms:   make(chan string),
+		mediaServers: newSingleMediaServerPool(mediaServerHost, NewSRSMediaServer(mediaServerHost)),
+		metrics:      metrics.New(),
+		iceServers:   NewICEServers(ICEConfig{}),
+		pusher:       NewPusher(NewMemoryPushTokenStore(), nil),
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	a.observers = append(a.observers, a.pusher, streamSessions{a})
+
+	a.metrics.RegisterRooms(a.roomStats)
+	a.sendQueue.OnDrop = func(reason string) {
+		a.metrics.SendDrops.WithLabelValues(reason).Inc()
 	}
 
 	// todo: все ок с местом запуска горутины?
@@ -75,38 +293,92 @@ func (a *App) Version(_ context.Context) []byte {
 	return []byte("1.0.1")
 }
 
+func (a *App) roomStats() metrics.RoomStats {
+	stats := metrics.RoomStats{}
+
+	a.rooms.Range(context.Background(), func(r *internalrooms.Room) bool {
+		participants, devices := r.Stats()
+
+		stats.Rooms++
+		stats.Participants += participants
+		stats.Devices += devices
+
+		return true
+	})
+
+	return stats
+}
+
 // WS todo: можно ли тут знать о *websocket.Conn ?
 func (a *App) WS(ctx context.Context, conn *websocket.Conn) {
 	ctx, cancel := context.WithCancel(logger.WithContext(ctx))
 	defer a.closeConnection(ctx, cancel, conn)
 
+	a.metrics.Connects.Inc()
+	defer a.metrics.Disconnects.Inc()
+
 	a.heartbeat(ctx, cancel, conn)
 
 	inMessages := make(chan []byte)
 	go a.handleInMessages(ctx, cancel, conn, inMessages)
 
-	preconnectMessages := make(chan []byte)
-	outMessages := make(chan []byte)
-	go a.handleOutMessages(ctx, cancel, inMessages, preconnectMessages, outMessages)
+	queue := internalrooms.NewQueue(a.sendQueue, func() {
+		logger.Wf(ctx, "[WS] Evict slow consumer %v", conn.RemoteAddr())
+		a.metrics.Evictions.Inc()
+		cancel()
+	})
+	go a.handleOutMessages(ctx, cancel, inMessages, queue)
+
+	a.writeMessages(ctx, conn, queue)
+}
 
+// writeMessages writes the queued messages to the connection until ctx is
+// done.
+func (a *App) writeMessages(ctx context.Context, conn *websocket.Conn, queue *internalrooms.Queue) {
 	for {
 		select {
 		case <-ctx.Done():
-			return
-		case m := <-preconnectMessages:
-			if err := conn.WriteMessage(websocket.TextMessage, m); err != nil {
-				logger.Wf(ctx, "[WS preconect] Ignore err %v for %v", err, conn.RemoteAddr())
-				break
+			// The last messages, a fatal error for one, are queued right
+			// before the connection is cancelled. A slow consumer is not
+			// waited for.
+			if !queue.Evicted() {
+				a.flush(ctx, conn, queue, time.Now().Add(writeWait))
 			}
-		case m := <-outMessages:
-			if err := conn.WriteMessage(websocket.TextMessage, m); err != nil {
-				logger.Wf(ctx, "[WS main] Ignore err %v for %v", err, conn.RemoteAddr())
-				break
+			return
+		case <-queue.Ready():
+			if !a.flush(ctx, conn, queue, time.Time{}) {
+				return
 			}
 		}
 	}
 }
 
+// flush writes the queued messages, each within writeWait unless deadline
+// bounds them all. It reports false if the connection failed.
+func (a *App) flush(ctx context.Context, conn *websocket.Conn, queue *internalrooms.Queue, deadline time.Time) bool {
+	for {
+		m, ok := queue.Pop()
+		if !ok {
+			return true
+		}
+
+		writeDeadline := deadline
+		if writeDeadline.IsZero() {
+			writeDeadline = time.Now().Add(writeWait)
+		}
+
+		if err := conn.SetWriteDeadline(writeDeadline); err != nil {
+			logger.Wf(ctx, "[WS] Set write deadline err %v for %v", err, conn.RemoteAddr())
+			return false
+		}
+
+		if err := conn.WriteMessage(websocket.TextMessage, m); err != nil {
+			logger.Wf(ctx, "[WS] Write err %v for %v", err, conn.RemoteAddr())
+			return false
+		}
+	}
+}
+
 func (a *App) manageRooms(ctx context.Context, cancel context.CancelFunc) {
 	defer cancel()
 
@@ -115,7 +387,24 @@ func (a *App) manageRooms(ctx context.Context, cancel context.CancelFunc) {
 		case <-ctx.Done():
 			return
 		case roomID := <-a.emptyRooms:
-			a.rooms.Delete(roomID)
+			r, loaded := a.rooms.Load(ctx, roomID)
+			if !loaded || !r.IsEmpty() {
+				continue
+			}
+
+			// A call nobody ended is over once its last participant left.
+			if snapshot := r.Snapshot(); snapshot.StartedAt != nil && snapshot.EndedAt == nil {
+				a.observers.Observe(ctx, internalrooms.Event{
+					Kind:      internalrooms.EndKind,
+					Room:      roomID,
+					StartedAt: snapshot.StartedAt,
+					Reason:    internalrooms.EmptyReason,
+				})
+			}
+
+			a.observers.Observe(ctx, internalrooms.Event{Kind: internalrooms.EmptyKind, Room: roomID})
+			r.Close()
+			a.rooms.Delete(ctx, roomID)
 		}
 	}
 }
@@ -191,63 +480,105 @@ func (a *App) handleOutMessages(
 	ctx context.Context,
 	cancel context.CancelFunc,
 	inMessages chan []byte,
-	preconnectMessages chan []byte,
-	outMessages chan []byte,
+	queue *internalrooms.Queue,
 ) {
 	defer cancel()
 
-	handleMessage := func(m []byte) error {
-		action := Action{}
-		if err := json.Unmarshal(m, &action); err != nil {
-			return errors.Wrapf(err, "Unmarshal %s", m)
+	s := &session{disconnect: cancel}
+
+	send := func(tid string, response interface{}) error {
+		message, err := json.Marshal(Tid{tid, response})
+		if err != nil {
+			return errors.Wrapf(err, "marshal")
 		}
 
+		if !queue.Push(message) {
+			return errors.Errorf("send queue is full")
+		}
+
+		return nil
+	}
+
+	handleMessage := func(m []byte, action Action) error {
 		var response interface{}
 		var err error
 
 		actionType := action.Message.Action
 
+		start := time.Now()
+		defer func() {
+			a.metrics.ActionDuration.WithLabelValues(actionLabel(actionType)).Observe(time.Since(start).Seconds())
+		}()
+		a.metrics.Actions.WithLabelValues(actionLabel(actionType)).Inc()
+
 		switch actionType {
 		case "preconnect":
-			response, err = handlePreconnect(ctx, a, m, action, preconnectMessages)
+			response, err = handlePreconnect(ctx, a, s, m, action, queue)
 			if err != nil {
 				return err
 			}
 		case "join":
-			response, err = handleJoin(ctx, a, m, action, outMessages)
+			response, err = handleJoin(ctx, a, s, m, action, queue)
+			if err != nil {
+				return err
+			}
+		case "resume":
+			response, err = handleResume(ctx, a, s, m, action, queue)
 			if err != nil {
 				return err
 			}
 		default:
 			handler, ok := handlers[actionType]
 			if !ok {
-				return errors.Errorf("unknown action")
+				return newError(CodeUnknownAction, errors.Errorf("unknown action %s", actionType))
 			}
 
-			response, err = handler(ctx, a, m, action)
+			response, err = handler(ctx, a, s, m, action)
 			if err != nil {
 				return err
 			}
 		}
 
-		message, err := json.Marshal(Tid{action.TID, response})
+		return send(action.TID, response)
+	}
+
+	for m := range inMessages {
+		action := Action{}
+		err := json.Unmarshal(m, &action)
 		if err != nil {
-			return errors.Wrapf(err, "marshal")
+			err = errors.Wrapf(err, "Unmarshal %s", m)
+		} else {
+			err = handleMessage(m, action)
 		}
 
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case outMessages <- message:
+		if err == nil {
+			continue
 		}
 
-		return nil
-	}
+		e := asError(err)
+		logger.Wf(ctx, "Handle %s err %v", m, err)
+		a.metrics.Errors.WithLabelValues(actionLabel(action.Message.Action), string(e.Code)).Inc()
 
-	for m := range inMessages {
-		if err := handleMessage(m); err != nil {
-			logger.Wf(ctx, "Handle %s err %v", m, err)
+		if err := send(action.TID, newResponseError(e)); err != nil {
+			break
+		}
+
+		if e.Fatal() {
 			break
 		}
 	}
 }
+
+// actionLabel keeps the metrics cardinality bounded by the known actions.
+func actionLabel(action string) string {
+	switch action {
+	case "preconnect", "join", "resume":
+		return action
+	}
+
+	if _, ok := handlers[action]; ok {
+		return action
+	}
+
+	return "unknown"
+}
@@ -0,0 +1,50 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+	internalrooms "signal/internal/rooms"
+)
+
+func TestWriteMessagesBeforeClose(t *testing.T) {
+	a := New(nil, "srs")
+
+	conns := make(chan *websocket.Conn, 1)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		conns <- conn
+	}))
+	defer server.Close()
+
+	// A fatal error is queued right before the connection is cancelled, the
+	// loop sees both at once.
+	for i := 0; i < 20; i++ {
+		client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+		require.NoError(t, err)
+		conn := <-conns
+
+		queue := internalrooms.NewQueue(internalrooms.QueueConfig{}, nil)
+		require.True(t, queue.Push([]byte(`{"code":"unauthorized"}`)))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		a.writeMessages(ctx, conn, queue)
+		conn.Close()
+
+		require.NoError(t, client.SetReadDeadline(time.Now().Add(time.Second)))
+		_, m, err := client.ReadMessage()
+		require.NoError(t, err)
+		require.JSONEq(t, `{"code":"unauthorized"}`, string(m))
+
+		client.Close()
+	}
+}
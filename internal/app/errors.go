@@ -0,0 +1,139 @@
+package app
+
+import (
+	"encoding/json"
+	stderrors "errors"
+
+	"github.com/ossrs/go-oryx-lib/errors"
+	internalrooms "signal/internal/rooms"
+)
+
+type ErrorCode string
+
+const (
+	CodeBadRequest          ErrorCode = "badRequest"
+	CodeUnknownAction       ErrorCode = "unknownAction"
+	CodeInvalidToken        ErrorCode = "invalidToken"
+	CodeUnauthorized        ErrorCode = "unauthorized"
+	CodeRoomNotFound        ErrorCode = "roomNotFound"
+	CodeParticipantExists   ErrorCode = "participantExists"
+	CodeParticipantNotFound ErrorCode = "participantNotFound"
+	CodeDeviceExists        ErrorCode = "deviceExists"
+	CodeDeviceNotFound      ErrorCode = "deviceNotFound"
+	CodeForbidden           ErrorCode = "forbidden"
+	CodeResumeFailed        ErrorCode = "resumeFailed"
+	CodeMediaServer         ErrorCode = "mediaServer"
+	CodeRoomFull            ErrorCode = "roomFull"
+	CodeRoomLocked          ErrorCode = "roomLocked"
+	CodeMessageTooLong      ErrorCode = "messageTooLong"
+	CodeRateLimited         ErrorCode = "rateLimited"
+	CodeStreamLimit         ErrorCode = "streamLimit"
+	CodeInternal            ErrorCode = "internal"
+)
+
+type errorInfo struct {
+	message string
+	// fatal errors close the connection, the rest are only reported.
+	fatal bool
+}
+
+var errorCatalogue = map[ErrorCode]errorInfo{
+	CodeBadRequest:          {message: "malformed message"},
+	CodeUnknownAction:       {message: "unknown action"},
+	CodeInvalidToken:        {message: "invalid token", fatal: true},
+	CodeUnauthorized:        {message: "not allowed for this connection", fatal: true},
+	CodeRoomNotFound:        {message: "room does not exist"},
+	CodeParticipantExists:   {message: "participant already joined the room"},
+	CodeParticipantNotFound: {message: "participant is not in the room"},
+	CodeDeviceExists:        {message: "device already connected to the room"},
+	CodeDeviceNotFound:      {message: "device is not connected to the room"},
+	CodeForbidden:           {message: "action is not allowed for this participant"},
+	CodeResumeFailed:        {message: "session can not be resumed, join again"},
+	CodeMediaServer:         {message: "media server request failed"},
+	CodeRoomFull:            {message: "room has no room for another participant"},
+	CodeRoomLocked:          {message: "room is locked by a moderator"},
+	CodeMessageTooLong:      {message: "message is too long"},
+	CodeRateLimited:         {message: "too many messages, slow down"},
+	CodeStreamLimit:         {message: "too many streams of this kind in the room"},
+	CodeInternal:            {message: "internal error", fatal: true},
+}
+
+// Error is a handler failure reported to the client.
+type Error struct {
+	Code ErrorCode
+	err  error
+}
+
+func newError(code ErrorCode, err error) *Error {
+	return &Error{Code: code, err: err}
+}
+
+func (e *Error) Error() string {
+	return string(e.Code) + ": " + e.err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// Message is the text sent to the client, it never contains internal details.
+func (e *Error) Message() string {
+	return errorCatalogue[e.Code].message
+}
+
+// Fatal reports whether the connection must be closed after the error.
+func (e *Error) Fatal() bool {
+	return errorCatalogue[e.Code].fatal
+}
+
+func newResponseError(e *Error) ResponseError {
+	return ResponseError{
+		Action:  "error",
+		Code:    e.Code,
+		Message: e.Message(),
+	}
+}
+
+// asError classifies an error returned by a handler.
+func asError(err error) *Error {
+	cause := errors.Cause(err)
+
+	var e *Error
+	if stderrors.As(cause, &e) {
+		return e
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case stderrors.As(cause, &syntaxErr), stderrors.As(cause, &typeErr):
+		return newError(CodeBadRequest, err)
+	case stderrors.Is(cause, internalrooms.ErrParticipantExists):
+		return newError(CodeParticipantExists, err)
+	case stderrors.Is(cause, internalrooms.ErrParticipantNotFound):
+		return newError(CodeParticipantNotFound, err)
+	case stderrors.Is(cause, internalrooms.ErrDeviceExists):
+		return newError(CodeDeviceExists, err)
+	case stderrors.Is(cause, internalrooms.ErrDeviceNotFound):
+		return newError(CodeDeviceNotFound, err)
+	case stderrors.Is(cause, internalrooms.ErrResumeFailed):
+		return newError(CodeResumeFailed, err)
+	case stderrors.Is(cause, internalrooms.ErrRoomFull):
+		return newError(CodeRoomFull, err)
+	case stderrors.Is(cause, internalrooms.ErrRoomLocked):
+		return newError(CodeRoomLocked, err)
+	case stderrors.Is(cause, internalrooms.ErrNotInviter):
+		return newError(CodeForbidden, err)
+	case stderrors.Is(cause, internalrooms.ErrMessageTooLong):
+		return newError(CodeMessageTooLong, err)
+	case stderrors.Is(cause, internalrooms.ErrRateLimited):
+		return newError(CodeRateLimited, err)
+	case stderrors.Is(cause, internalrooms.ErrStreamLimit):
+		return newError(CodeStreamLimit, err)
+	case stderrors.Is(cause, internalrooms.ErrUnknownStream):
+		return newError(CodeBadRequest, err)
+	default:
+		return newError(CodeInternal, err)
+	}
+}
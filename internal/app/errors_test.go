@@ -0,0 +1,80 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/ossrs/go-oryx-lib/errors"
+	"github.com/stretchr/testify/require"
+	internalrooms "signal/internal/rooms"
+)
+
+func TestAsError(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		code  ErrorCode
+		fatal bool
+	}{
+		{
+			name: "Malformed message",
+			err:  errors.Wrapf(json.Unmarshal([]byte("{"), &Action{}), "Unmarshal"),
+			code: CodeBadRequest,
+		},
+		{
+			name: "Participant not found",
+			err: errors.Wrapf(
+				fmt.Errorf("%w: 1 in room call", internalrooms.ErrParticipantNotFound),
+				"changeState",
+			),
+			code: CodeParticipantNotFound,
+		},
+		{
+			name: "Room full",
+			err:  errors.Wrapf(fmt.Errorf("%w: call has 2 participants", internalrooms.ErrRoomFull), "join"),
+			code: CodeRoomFull,
+		},
+		{
+			name: "Room locked",
+			err:  errors.Wrapf(fmt.Errorf("%w: call", internalrooms.ErrRoomLocked), "join"),
+			code: CodeRoomLocked,
+		},
+		{
+			name: "Not the inviter",
+			err:  errors.Wrapf(fmt.Errorf("%w: 3 did not invite 2", internalrooms.ErrNotInviter), "cancelInvite"),
+			code: CodeForbidden,
+		},
+		{
+			name: "Rate limited",
+			err:  errors.Wrapf(fmt.Errorf("%w: 1 sent 10 messages in 10s", internalrooms.ErrRateLimited), "chat"),
+			code: CodeRateLimited,
+		},
+		{
+			name: "Stream limit",
+			err:  errors.Wrapf(fmt.Errorf("%w: call shares 1 screens", internalrooms.ErrStreamLimit), "streamPublish"),
+			code: CodeStreamLimit,
+		},
+		{
+			name:  "Invalid token",
+			err:   errors.Wrapf(newError(CodeInvalidToken, errors.New("expired")), "join"),
+			code:  CodeInvalidToken,
+			fatal: true,
+		},
+		{
+			name:  "Unknown failure",
+			err:   errors.New("boom"),
+			code:  CodeInternal,
+			fatal: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := asError(tt.err)
+			require.Equal(t, tt.code, e.Code)
+			require.Equal(t, tt.fatal, e.Fatal())
+			require.NotEmpty(t, e.Message())
+		})
+	}
+}
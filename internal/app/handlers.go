@@ -2,19 +2,20 @@ package app
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
-	"fmt"
-	"strconv"
+	"time"
 
 	"github.com/ossrs/go-oryx-lib/errors"
 	"github.com/ossrs/go-oryx-lib/logger"
-	client "signal/internal/restclient"
 	internalrooms "signal/internal/rooms"
 )
 
 type ActionHandler func(
 	ctx context.Context,
 	a *App,
+	s *session,
 	m []byte,
 	action Action,
 ) (interface{}, error)
@@ -22,9 +23,10 @@ type ActionHandler func(
 func handlePreconnect(
 	ctx context.Context,
 	a *App,
+	s *session,
 	m []byte,
 	action Action,
-	outMessages chan []byte,
+	queue *internalrooms.Queue,
 ) (interface{}, error) {
 	logger.Tf(ctx, "Preconnect start")
 
@@ -33,42 +35,52 @@ func handlePreconnect(
 		return nil, errors.Wrapf(err, "Unmarshal %s", m)
 	}
 
-	r, loaded := a.rooms.Load(obj.Message.Room)
+	if _, err := a.authenticate(s, obj.Message.Token, obj.Message.Room, obj.Message.UserID); err != nil {
+		return nil, errors.Wrapf(err, "preconnect")
+	}
 
-	if !loaded {
-		r = &internalrooms.Room{
-			Name:  obj.Message.Room,
-			Token: obj.Message.Token,
-		}
+	token := a.roomToken(obj.Message.Token)
+
+	template, err := a.newRoom(obj.Message.Room, token, obj.Message.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	r, loaded, err := a.rooms.LoadOrStore(ctx, template)
+	if err != nil {
+		return nil, errors.Wrapf(err, "preconnect")
+	}
 
-		a.rooms.Store(obj.Message.Room, r)
-	} else if r.(*internalrooms.Room).Token != obj.Message.Token {
-		return nil, errors.Errorf("Invalid token for room %s", obj.Message.Room)
+	if loaded && r.Token != token {
+		return nil, newError(CodeInvalidToken, errors.Errorf("Invalid token for room %s", obj.Message.Room))
 	}
 
 	d := &internalrooms.Device{
-		Room:   r.(*internalrooms.Room),
-		Out:    outMessages,
+		Room:   r,
+		Out:    queue,
 		UserID: obj.Message.UserID,
 		ID:     obj.Message.DeviceID,
 		Status: "",
 	}
 
-	err := r.(*internalrooms.Room).AddDevice(d)
+	err = r.AddDevice(d)
 	if err != nil {
 		return nil, err
 	}
 
-	device, err := r.(*internalrooms.Room).GetDeviceHistory(obj.Message.UserID)
+	device, err := r.GetDeviceHistory(obj.Message.UserID)
 	if err != nil {
 		return nil, err
 	}
 
 	go d.HandleContextDone(ctx)
+	go r.UpdateInvite(ctx, d)
 
 	response := ResponsePreconnect{
-		Action: action.Message.Action,
-		Device: device,
+		Action:     action.Message.Action,
+		Device:     device,
+		CallState:  r.CallState(obj.Message.UserID),
+		CallStates: r.CallStates(),
 	}
 
 	logger.Tf(ctx, "History: %v", device)
@@ -80,6 +92,7 @@ func handlePreconnect(
 func handleAccept(
 	ctx context.Context,
 	a *App,
+	s *session,
 	m []byte,
 	action Action,
 ) (interface{}, error) {
@@ -90,19 +103,23 @@ func handleAccept(
 		return nil, errors.Wrapf(err, "Unmarshal %s", m)
 	}
 
-	r, loaded := a.rooms.Load(obj.Message.Room)
+	if err := a.authorize(s, obj.Message.Room, obj.Message.UserID); err != nil {
+		return nil, err
+	}
+
+	r, loaded := a.rooms.Load(ctx, obj.Message.Room)
 	if !loaded {
-		return nil, errors.Errorf("room %s does not exist", obj.Message.Room)
+		return nil, newError(CodeRoomNotFound, errors.Errorf("room %s does not exist", obj.Message.Room))
 	}
 
-	d, err := r.(*internalrooms.Room).Accept(obj.Message.DeviceID)
+	d, err := r.Accept(obj.Message.UserID, obj.Message.DeviceID)
 	if err != nil {
 		return nil, err
 	}
 
 	logger.Tf(ctx, "Accept %v ok", d)
 
-	go r.(*internalrooms.Room).NotifyPreconnect(ctx, d, action.Message.Action)
+	go r.NotifyPreconnect(ctx, d, action.Message.Action)
 
 	return nil, nil
 }
@@ -110,6 +127,7 @@ func handleAccept(
 func handleDecline(
 	ctx context.Context,
 	a *App,
+	s *session,
 	m []byte,
 	action Action,
 ) (interface{}, error) {
@@ -120,19 +138,23 @@ func handleDecline(
 		return nil, errors.Wrapf(err, "Unmarshal %s", m)
 	}
 
-	r, loaded := a.rooms.Load(obj.Message.Room)
+	if err := a.authorize(s, obj.Message.Room, obj.Message.UserID); err != nil {
+		return nil, err
+	}
+
+	r, loaded := a.rooms.Load(ctx, obj.Message.Room)
 	if !loaded {
-		return nil, errors.Errorf("room %s does not exist", obj.Message.Room)
+		return nil, newError(CodeRoomNotFound, errors.Errorf("room %s does not exist", obj.Message.Room))
 	}
 
-	d, err := r.(*internalrooms.Room).Decline(obj.Message.DeviceID)
+	d, err := r.Decline(obj.Message.UserID, obj.Message.DeviceID)
 	if err != nil {
 		return nil, err
 	}
 
 	logger.Tf(ctx, "Decline %v ok", d)
 
-	go r.(*internalrooms.Room).NotifyPreconnect(ctx, d, action.Message.Action)
+	go r.NotifyPreconnect(ctx, d, action.Message.Action)
 
 	return nil, nil
 }
@@ -140,6 +162,7 @@ func handleDecline(
 func handleBusy(
 	ctx context.Context,
 	a *App,
+	s *session,
 	m []byte,
 	action Action,
 ) (interface{}, error) {
@@ -150,19 +173,23 @@ func handleBusy(
 		return nil, errors.Wrapf(err, "Unmarshal %s", m)
 	}
 
-	r, loaded := a.rooms.Load(obj.Message.Room)
+	if err := a.authorize(s, obj.Message.Room, obj.Message.UserID); err != nil {
+		return nil, err
+	}
+
+	r, loaded := a.rooms.Load(ctx, obj.Message.Room)
 	if !loaded {
-		return nil, errors.Errorf("room %s does not exist", obj.Message.Room)
+		return nil, newError(CodeRoomNotFound, errors.Errorf("room %s does not exist", obj.Message.Room))
 	}
 
-	d, err := r.(*internalrooms.Room).Busy(obj.Message.DeviceID)
+	d, err := r.Busy(obj.Message.UserID, obj.Message.DeviceID)
 	if err != nil {
 		return nil, err
 	}
 
 	logger.Tf(ctx, "Busy %v ok", d)
 
-	go r.(*internalrooms.Room).NotifyPreconnect(ctx, d, action.Message.Action)
+	go r.NotifyPreconnect(ctx, d, action.Message.Action)
 
 	return nil, nil
 }
@@ -170,61 +197,173 @@ func handleBusy(
 func handleJoin(
 	ctx context.Context,
 	a *App,
+	s *session,
 	m []byte,
 	action Action,
-	outMessages chan []byte,
+	queue *internalrooms.Queue,
 ) (interface{}, error) {
 	obj := EventJoin{}
 	if err := json.Unmarshal(m, &obj); err != nil {
 		return nil, errors.Wrapf(err, "Unmarshal %s", m)
 	}
 
-	r, loaded := a.rooms.Load(obj.Message.Room)
+	claims, err := a.authenticate(s, obj.Message.Token, obj.Message.Room, obj.Message.UserID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "join")
+	}
 
-	if !loaded {
-		r = &internalrooms.Room{
-			Name:  obj.Message.Room,
-			Token: obj.Message.Token,
-		}
+	switch obj.Message.Mode {
+	case "", internalrooms.SFUMode, internalrooms.P2PMode:
+	default:
+		return nil, newError(CodeBadRequest, errors.Errorf("unknown mode %q", obj.Message.Mode))
+	}
+
+	role, err := a.participantRole(claims, obj.Message.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	resumeToken, err := newResumeToken()
+	if err != nil {
+		return nil, errors.Wrapf(err, "join")
+	}
+
+	token := a.roomToken(obj.Message.Token)
+
+	template, err := a.newRoom(obj.Message.Room, token, obj.Message.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	r, loaded, err := a.rooms.LoadOrStore(ctx, template)
+	if err != nil {
+		return nil, errors.Wrapf(err, "join")
+	}
 
-		a.rooms.Store(obj.Message.Room, r)
-	} else if r.(*internalrooms.Room).Token != obj.Message.Token {
-		return nil, errors.Errorf("Invalid token for room %s", obj.Message.Room)
+	if loaded && r.Token != token {
+		return nil, newError(CodeInvalidToken, errors.Errorf("Invalid token for room %s", obj.Message.Room))
 	}
 
+	participantCtx, leave := context.WithCancel(ctx)
+
 	p := &internalrooms.Participant{
-		Room:         r.(*internalrooms.Room),
-		Out:          outMessages,
+		Room:         r,
+		Out:          queue,
+		Cancel:       leave,
+		Disconnect:   s.disconnect,
 		UserID:       obj.Message.UserID,
+		Role:         role,
 		FirstName:    obj.Message.FirstName,
 		LastName:     obj.Message.LastName,
 		Status:       obj.Message.Status,
 		Sex:          obj.Message.Sex,
 		Photo:        obj.Message.Photo,
-		Publishing:   false,
 		IsHorizontal: obj.Message.IsHorizontal,
 		IsMicroOn:    obj.Message.IsMicroOn,
 		IsSpeakerOn:  obj.Message.IsSpeakerOn,
 		CameraType:   obj.Message.CameraType,
 		BatteryLife:  obj.Message.BatteryLife,
 		IsReady:      false,
+		ResumeToken:  resumeToken,
+	}
+	if err := r.Add(p); err != nil {
+		leave()
+		return nil, errors.Wrapf(err, "join")
 	}
-	if err := r.(*internalrooms.Room).Add(p); err != nil {
+
+	// The first participant decides how the room negotiates its media.
+	mode := r.ChooseMode(ctx, obj.Message.Mode)
+
+	// The caller may invite the callees along with creating the room.
+	if err := a.invite(ctx, r, p, obj.Message.InvitedParticipants); err != nil {
+		leave()
+		a.abandon(r, p)
 		return nil, errors.Wrapf(err, "join")
 	}
 
-	go p.HandleContextDone(ctx, a.emptyRooms)
-	logger.Tf(ctx, "Join %v ok", p)
+	go p.HandleContextDone(participantCtx, a.emptyRooms, a.resumeGrace)
+	logger.Tf(ctx, "Join %v ok, mode %v", p, mode)
 
 	response := ResponseJoin{
 		Action:              action.Message.Action,
 		Self:                p,
-		Participants:        r.(*internalrooms.Room).Participants,
-		InvitedParticipants: r.(*internalrooms.Room).InvitedParticipants,
-		StartedAt:           r.(*internalrooms.Room).StartedAt,
+		Participants:        r.Participants,
+		InvitedParticipants: r.InvitedParticipants,
+		StartedAt:           r.StartedAt,
+		ResumeToken:         p.ResumeToken,
+		Mode:                mode,
+		Type:                r.Type,
+		IceServers:          a.iceServers.For(p.UserID),
+		ActiveSpeaker:       r.ActiveSpeaker(),
+		ChatHistory:         r.ChatHistory(p.UserID),
+		Hands:               r.Hands(),
+	}
+
+	go r.Notify(ctx, p, action.Message.Action)
+
+	return response, nil
+}
+
+func handleResume(
+	ctx context.Context,
+	a *App,
+	s *session,
+	m []byte,
+	action Action,
+	queue *internalrooms.Queue,
+) (interface{}, error) {
+	logger.Tf(ctx, "Resume start")
+
+	obj := EventResume{}
+	if err := json.Unmarshal(m, &obj); err != nil {
+		return nil, errors.Wrapf(err, "Unmarshal %s", m)
+	}
+
+	if s.userID != 0 && s.userID != obj.Message.UserID {
+		return nil, newError(CodeUnauthorized, errors.Errorf("connection belongs to user %d", s.userID))
+	}
+
+	r, loaded := a.rooms.Load(ctx, obj.Message.Room)
+	if !loaded {
+		return nil, newError(CodeRoomNotFound, errors.Errorf("room %s does not exist", obj.Message.Room))
+	}
+
+	p, err := r.Get(obj.Message.UserID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "resume")
+	}
+
+	participantCtx, leave := context.WithCancel(ctx)
+
+	missed, err := p.Resume(obj.Message.ResumeToken, queue, leave, s.disconnect)
+	if err != nil {
+		leave()
+		return nil, errors.Wrapf(err, "resume")
+	}
+
+	// The resume token proves the identity and the room established by the
+	// original join.
+	s.bind(p.UserID, obj.Message.Room)
+
+	go p.HandleContextDone(participantCtx, a.emptyRooms, a.resumeGrace)
+	logger.Tf(ctx, "Resume %v ok, missed %d", p, len(missed))
+
+	replay := make([]json.RawMessage, 0, len(missed))
+	for _, message := range missed {
+		replay = append(replay, message)
+	}
+
+	response := ResponseResume{
+		Action:              action.Message.Action,
+		Self:                p,
+		Participants:        r.Participants,
+		InvitedParticipants: r.InvitedParticipants,
+		StartedAt:           r.StartedAt,
+		Hands:               r.Hands(),
+		Missed:              replay,
 	}
 
-	go r.(*internalrooms.Room).Notify(ctx, p, action.Message.Action)
+	go r.Notify(ctx, p, internalrooms.ResumeEvent)
 
 	return response, nil
 }
@@ -232,6 +371,7 @@ func handleJoin(
 func handlePublish(
 	ctx context.Context,
 	a *App,
+	s *session,
 	m []byte,
 	action Action,
 ) (interface{}, error) {
@@ -242,21 +382,77 @@ func handlePublish(
 		return nil, errors.Wrapf(err, "Unmarshal %s", m)
 	}
 
-	r, loaded := a.rooms.Load(obj.Message.Room)
+	if err := a.authorize(s, obj.Message.Room, obj.Message.UserID); err != nil {
+		return nil, err
+	}
+
+	r, loaded := a.rooms.Load(ctx, obj.Message.Room)
 	if !loaded {
-		return nil, errors.Errorf("room %s does not exist", obj.Message.Room)
+		return nil, newError(CodeRoomNotFound, errors.Errorf("room %s does not exist", obj.Message.Room))
+	}
+
+	p, err := r.Get(obj.Message.UserID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "publish")
 	}
 
-	p, err := r.(*internalrooms.Room).Get(obj.Message.UserID)
+	kind, err := internalrooms.StreamKind(obj.Message.Stream)
+	if err != nil {
+		return nil, newError(CodeBadRequest, err)
+	}
+
+	published, err := r.Publish(p, kind)
 	if err != nil {
 		return nil, errors.Wrapf(err, "publish")
 	}
 
-	r.(*internalrooms.Room).ChangePublishing(p, true)
+	logger.Tf(ctx, "Publish %s of %v ok", kind, p)
+
+	if !published {
+		return nil, nil
+	}
+
+	go r.NotifyStream(ctx, p, action.Message.Action, kind)
+
+	return nil, nil
+}
+
+func handleUnpublish(
+	ctx context.Context,
+	a *App,
+	s *session,
+	m []byte,
+	_ Action,
+) (interface{}, error) {
+	logger.Tf(ctx, "Unpublish start")
+
+	obj := EventUnpublish{}
+	if err := json.Unmarshal(m, &obj); err != nil {
+		return nil, errors.Wrapf(err, "Unmarshal %s", m)
+	}
+
+	if err := a.authorize(s, obj.Message.Room, obj.Message.UserID); err != nil {
+		return nil, err
+	}
+
+	r, loaded := a.rooms.Load(ctx, obj.Message.Room)
+	if !loaded {
+		return nil, newError(CodeRoomNotFound, errors.Errorf("room %s does not exist", obj.Message.Room))
+	}
+
+	p, err := r.Get(obj.Message.UserID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unpublish")
+	}
+
+	kind, err := internalrooms.StreamKind(obj.Message.Stream)
+	if err != nil {
+		return nil, newError(CodeBadRequest, err)
+	}
 
-	logger.Tf(ctx, "Publish %v ok", p)
+	ended := r.Unpublish(ctx, p, kind)
 
-	go r.(*internalrooms.Room).Notify(ctx, p, action.Message.Action)
+	logger.Tf(ctx, "Unpublish %s of %v ok, ended %v", kind, p, ended)
 
 	return nil, nil
 }
@@ -264,6 +460,7 @@ func handlePublish(
 func handleStreamPublish(
 	ctx context.Context,
 	a *App,
+	s *session,
 	m []byte,
 	_ Action,
 ) (interface{}, error) {
@@ -274,40 +471,55 @@ func handleStreamPublish(
 		return nil, errors.Wrapf(err, "Unmarshal %s", m)
 	}
 
-	r, loaded := a.rooms.Load(obj.Message.Room)
+	if err := a.authorize(s, obj.Message.Room, obj.Message.UserID); err != nil {
+		return nil, err
+	}
+
+	r, loaded := a.rooms.Load(ctx, obj.Message.Room)
 	if !loaded {
 		return nil, nil
 	}
 
-	p, err := r.(*internalrooms.Room).Get(obj.Message.UserID)
+	p, err := r.Get(obj.Message.UserID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "streamPublish")
 	}
 
-	logger.Tf(ctx, "Publish stream peer: %v", p)
+	kind, err := internalrooms.StreamKind(obj.Message.Stream)
+	if err != nil {
+		return nil, newError(CodeBadRequest, err)
+	}
 
-	data := Stream{
-		StreamURL: getWebrtcURL(a.mediaServerHost, r.(*internalrooms.Room).Name, p.UserID),
-		Sdp:       obj.Message.SDP,
+	// The limit is enforced again when the stream is announced with publish.
+	if err := r.CanPublish(p, kind); err != nil {
+		return nil, errors.Wrapf(err, "streamPublish")
 	}
 
-	body, err := client.New().Post(ctx, "https://"+a.mediaServerHost+"/rtc/v1/publish/", data)
+	logger.Tf(ctx, "Publish stream %s peer: %v", kind, p)
+
+	start := time.Now()
+	response, err := a.mediaServers.Publish(ctx, r, StreamRequest{
+		Room:   r.Name,
+		UserID: p.UserID,
+		Stream: kind,
+		SDP:    obj.Message.SDP,
+	})
+	a.observeMediaServer("publish", start, err)
 	if err != nil {
-		return nil, errors.Wrapf(err, "streamPublish (post)")
+		return nil, newError(CodeMediaServer, errors.Wrapf(err, "streamPublish"))
 	}
 
-	var response ResponseStream
-	err = json.Unmarshal(body, &response)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response data: %w", err)
+	if response.SessionID != "" {
+		r.SetSession(p, kind, internalrooms.StreamSession{MediaServer: response.Server, ID: response.SessionID})
 	}
 
-	return &response, nil
+	return response, nil
 }
 
 func handleStreamPlay(
 	ctx context.Context,
 	a *App,
+	s *session,
 	m []byte,
 	_ Action,
 ) (interface{}, error) {
@@ -318,40 +530,46 @@ func handleStreamPlay(
 		return nil, errors.Wrapf(err, "Unmarshal %s", m)
 	}
 
-	r, loaded := a.rooms.Load(obj.Message.Room)
+	if err := a.authorize(s, obj.Message.Room, obj.Message.UserID); err != nil {
+		return nil, err
+	}
+
+	r, loaded := a.rooms.Load(ctx, obj.Message.Room)
 	if !loaded {
 		return nil, nil
 	}
 
-	p, err := r.(*internalrooms.Room).Get(obj.Message.UserID)
+	p, err := r.Get(obj.Message.UserID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "streamPlay")
 	}
 
-	logger.Tf(ctx, "Play stream peer: %v", p)
-
-	data := Stream{
-		StreamURL: getWebrtcURL(a.mediaServerHost, r.(*internalrooms.Room).Name, obj.Message.ParticipantID),
-		Sdp:       obj.Message.SDP,
-	}
-
-	body, err := client.New().Post(ctx, "https://"+a.mediaServerHost+"/rtc/v1/play/", data)
+	kind, err := internalrooms.StreamKind(obj.Message.Stream)
 	if err != nil {
-		return nil, errors.Wrapf(err, "streamPlay (post)")
+		return nil, newError(CodeBadRequest, err)
 	}
 
-	var response ResponseStream
-	err = json.Unmarshal(body, &response)
+	logger.Tf(ctx, "Play stream %s peer: %v", kind, p)
+
+	start := time.Now()
+	response, err := a.mediaServers.Play(ctx, r, StreamRequest{
+		Room:   r.Name,
+		UserID: obj.Message.ParticipantID,
+		Stream: kind,
+		SDP:    obj.Message.SDP,
+	})
+	a.observeMediaServer("play", start, err)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response data: %w", err)
+		return nil, newError(CodeMediaServer, errors.Wrapf(err, "streamPlay"))
 	}
 
-	return &response, nil
+	return response, nil
 }
 
 func handleReady(
 	ctx context.Context,
 	a *App,
+	s *session,
 	m []byte,
 	action Action,
 ) (interface{}, error) {
@@ -360,19 +578,23 @@ func handleReady(
 		return nil, errors.Wrapf(err, "Unmarshal %s", m)
 	}
 
-	r, loaded := a.rooms.Load(obj.Message.Room)
+	if err := a.authorize(s, obj.Message.Room, obj.Message.UserID); err != nil {
+		return nil, err
+	}
+
+	r, loaded := a.rooms.Load(ctx, obj.Message.Room)
 	if !loaded {
 		return nil, nil
 	}
 
-	p, err := r.(*internalrooms.Room).Get(obj.Message.UserID)
+	p, err := r.Get(obj.Message.UserID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "ready")
 	}
 
-	r.(*internalrooms.Room).Ready(p)
+	r.Ready(p)
 
-	go r.(*internalrooms.Room).Notify(ctx, p, action.Message.Action)
+	go r.Notify(ctx, p, action.Message.Action)
 
 	return nil, nil
 }
@@ -380,6 +602,7 @@ func handleReady(
 func handleChangeState(
 	ctx context.Context,
 	a *App,
+	s *session,
 	m []byte,
 	action Action,
 ) (interface{}, error) {
@@ -388,17 +611,21 @@ func handleChangeState(
 		return nil, errors.Wrapf(err, "Unmarshal %s", m)
 	}
 
-	r, loaded := a.rooms.Load(obj.Message.Room)
+	if err := a.authorize(s, obj.Message.Room, obj.Message.UserID); err != nil {
+		return nil, err
+	}
+
+	r, loaded := a.rooms.Load(ctx, obj.Message.Room)
 	if !loaded {
 		return nil, nil
 	}
 
-	p, err := r.(*internalrooms.Room).Get(obj.Message.UserID)
+	p, err := r.Get(obj.Message.UserID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "changeState")
 	}
 
-	r.(*internalrooms.Room).ChangeState(
+	r.ChangeState(
 		p,
 		internalrooms.State{
 			IsMicroOn:   obj.Message.IsMicroOn,
@@ -408,7 +635,7 @@ func handleChangeState(
 		},
 	)
 
-	go r.(*internalrooms.Room).Notify(ctx, p, action.Message.Action)
+	go r.Notify(ctx, p, action.Message.Action)
 
 	return nil, nil
 }
@@ -416,6 +643,7 @@ func handleChangeState(
 func handleSpeak(
 	ctx context.Context,
 	a *App,
+	s *session,
 	m []byte,
 	action Action,
 ) (interface{}, error) {
@@ -424,17 +652,21 @@ func handleSpeak(
 		return nil, errors.Wrapf(err, "Unmarshal %s", m)
 	}
 
-	r, loaded := a.rooms.Load(obj.Message.Room)
+	if err := a.authorize(s, obj.Message.Room, obj.Message.UserID); err != nil {
+		return nil, err
+	}
+
+	r, loaded := a.rooms.Load(ctx, obj.Message.Room)
 	if !loaded {
 		return nil, nil
 	}
 
-	p, err := r.(*internalrooms.Room).Get(obj.Message.UserID)
+	p, err := r.Get(obj.Message.UserID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "speak")
 	}
 
-	go r.(*internalrooms.Room).NotifySpeak(ctx, p.UserID, obj.Message.Level, action.Message.Action)
+	go r.Speak(ctx, p.UserID, obj.Message.Level)
 
 	return nil, nil
 }
@@ -442,6 +674,7 @@ func handleSpeak(
 func handleInviteUsers(
 	ctx context.Context,
 	a *App,
+	s *session,
 	m []byte,
 	action Action,
 ) (interface{}, error) {
@@ -452,37 +685,721 @@ func handleInviteUsers(
 		return nil, errors.Wrapf(err, "Unmarshal %s", m)
 	}
 
-	r, loaded := a.rooms.Load(obj.Message.Room)
+	if err := a.authorize(s, obj.Message.Room, obj.Message.UserID); err != nil {
+		return nil, err
+	}
+
+	r, loaded := a.rooms.Load(ctx, obj.Message.Room)
 	if !loaded {
-		return nil, errors.Errorf("room %s does not exist", obj.Message.Room)
+		return nil, newError(CodeRoomNotFound, errors.Errorf("room %s does not exist", obj.Message.Room))
 	}
 
-	p, err := r.(*internalrooms.Room).Get(obj.Message.UserID)
+	p, err := r.Get(obj.Message.UserID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "inviteUsers")
 	}
 
-	for _, value := range obj.Message.Participants {
-		invitedPeer := &internalrooms.InvitedParticipant{
-			Room:      r.(*internalrooms.Room),
-			UserID:    value.UserID,
-			FirstName: value.FirstName,
-			LastName:  value.LastName,
-			Status:    value.Status,
-			Photo:     value.Photo,
-		}
-		if err := r.(*internalrooms.Room).AddInvited(invitedPeer); err != nil {
-			return nil, errors.Wrapf(err, "inviteUsers")
+	if err := a.invite(ctx, r, p, obj.Message.Participants); err != nil {
+		return nil, errors.Wrapf(err, "inviteUsers")
+	}
+
+	go r.Notify(ctx, p, action.Message.Action)
+
+	return nil, nil
+}
+
+func handleRegisterPushToken(
+	ctx context.Context,
+	a *App,
+	s *session,
+	m []byte,
+	action Action,
+) (interface{}, error) {
+	obj := EventRegisterPushToken{}
+	if err := json.Unmarshal(m, &obj); err != nil {
+		return nil, errors.Wrapf(err, "Unmarshal %s", m)
+	}
+
+	// Devices may register before they ever join, with a token of a room.
+	if obj.Message.Token != "" {
+		if _, err := a.authenticate(s, obj.Message.Token, obj.Message.Room, obj.Message.UserID); err != nil {
+			return nil, errors.Wrapf(err, "registerPushToken")
 		}
+	} else if err := a.authorize(s, obj.Message.Room, obj.Message.UserID); err != nil {
+		return nil, err
+	}
 
-		logger.Tf(ctx, "InviteUser %v ok", invitedPeer)
+	switch obj.Message.Platform {
+	case FCMPlatform, APNsPlatform:
+	default:
+		return nil, newError(CodeBadRequest, errors.Errorf("unknown push platform %q", obj.Message.Platform))
+	}
+
+	if obj.Message.PushToken == "" {
+		return nil, newError(CodeBadRequest, errors.Errorf("empty push token"))
+	}
+
+	token := PushToken{
+		UserID:   obj.Message.UserID,
+		DeviceID: obj.Message.DeviceID,
+		Platform: obj.Message.Platform,
+		Token:    obj.Message.PushToken,
+		VoIP:     obj.Message.VoIP,
+	}
+	if err := a.pusher.Register(ctx, token); err != nil {
+		return nil, errors.Wrapf(err, "registerPushToken")
+	}
+
+	logger.Tf(ctx, "RegisterPushToken %d device %s %s ok", token.UserID, token.DeviceID, token.Platform)
+
+	return ResponseRegisterPushToken{Action: action.Message.Action}, nil
+}
+
+func handleCancelInvite(
+	ctx context.Context,
+	a *App,
+	s *session,
+	m []byte,
+	_ Action,
+) (interface{}, error) {
+	obj := EventCancelInvite{}
+	if err := json.Unmarshal(m, &obj); err != nil {
+		return nil, errors.Wrapf(err, "Unmarshal %s", m)
 	}
 
-	go r.(*internalrooms.Room).Notify(ctx, p, action.Message.Action)
+	if err := a.authorize(s, obj.Message.Room, obj.Message.UserID); err != nil {
+		return nil, err
+	}
+
+	r, loaded := a.rooms.Load(ctx, obj.Message.Room)
+	if !loaded {
+		return nil, newError(CodeRoomNotFound, errors.Errorf("room %s does not exist", obj.Message.Room))
+	}
+
+	p, err := r.Get(obj.Message.UserID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cancelInvite")
+	}
+
+	cancelled, err := r.CancelInvite(ctx, obj.Message.TargetUserID, p)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cancelInvite")
+	}
+	if !cancelled {
+		return nil, newError(CodeBadRequest, errors.Errorf("user %d is not invited to room %s", obj.Message.TargetUserID, r.Name))
+	}
+
+	logger.Tf(ctx, "CancelInvite %d by %d ok", obj.Message.TargetUserID, p.UserID)
+
+	return nil, nil
+}
+
+func handleLeave(
+	ctx context.Context,
+	a *App,
+	s *session,
+	m []byte,
+	_ Action,
+) (interface{}, error) {
+	logger.Tf(ctx, "Leave start")
+
+	obj := EventLeave{}
+	if err := json.Unmarshal(m, &obj); err != nil {
+		return nil, errors.Wrapf(err, "Unmarshal %s", m)
+	}
+
+	if err := a.authorize(s, obj.Message.Room, obj.Message.UserID); err != nil {
+		return nil, err
+	}
+
+	r, loaded := a.rooms.Load(ctx, obj.Message.Room)
+	if !loaded {
+		return nil, newError(CodeRoomNotFound, errors.Errorf("room %s does not exist", obj.Message.Room))
+	}
+
+	p, err := r.Get(obj.Message.UserID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "leave")
+	}
+
+	p.Leave()
+
+	logger.Tf(ctx, "Leave %v ok", p)
+
+	return nil, nil
+}
+
+func handleHangup(
+	ctx context.Context,
+	a *App,
+	s *session,
+	m []byte,
+	_ Action,
+) (interface{}, error) {
+	logger.Tf(ctx, "Hangup start")
+
+	obj := EventHangup{}
+	if err := json.Unmarshal(m, &obj); err != nil {
+		return nil, errors.Wrapf(err, "Unmarshal %s", m)
+	}
+
+	if err := a.authorize(s, obj.Message.Room, obj.Message.UserID); err != nil {
+		return nil, err
+	}
+
+	r, loaded := a.rooms.Load(ctx, obj.Message.Room)
+	if !loaded {
+		return nil, newError(CodeRoomNotFound, errors.Errorf("room %s does not exist", obj.Message.Room))
+	}
+
+	p, err := r.Get(obj.Message.UserID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "hangup")
+	}
+
+	if p.Role != internalrooms.HostRole {
+		return nil, newError(CodeForbidden, errors.Errorf("user %d is not the host of room %s", p.UserID, r.Name))
+	}
+
+	go r.End(context.Background(), p.UserID, internalrooms.HangupReason)
+
+	logger.Tf(ctx, "Hangup %v ok", p)
 
 	return nil, nil
 }
 
-func getWebrtcURL(host string, roomName string, userID int64) string {
-	return "webrtc://" + host + "/" + roomName + "/" + strconv.Itoa(int(userID))
+// authenticate verifies the token of a preconnect or join and binds the
+// connection to its user. Without a verifier the client is trusted.
+func (a *App) authenticate(s *session, token string, room string, userID int64) (*TokenClaims, error) {
+	if a.verifier == nil {
+		return nil, nil
+	}
+
+	claims, err := a.verifier.Verify(token, room, userID)
+	if err != nil {
+		return nil, newError(CodeInvalidToken, err)
+	}
+
+	if s.userID != 0 && s.userID != userID {
+		return nil, newError(CodeUnauthorized, errors.Errorf("connection belongs to user %d", s.userID))
+	}
+
+	s.bind(userID, room)
+
+	return claims, nil
+}
+
+// participantRole is the role of a joining participant. A role in the
+// token wins, otherwise clients may only ask to be a member or a viewer
+// unless tokens are not verified. An empty role lets the room make its
+// creator the host.
+func (a *App) participantRole(claims *TokenClaims, requested string) (string, error) {
+	if claims != nil && claims.Role != "" {
+		requested = claims.Role
+	}
+
+	switch requested {
+	case "", internalrooms.MemberRole, internalrooms.ViewerRole:
+	case internalrooms.HostRole, internalrooms.ModeratorRole:
+		if a.verifier != nil && (claims == nil || claims.Role != requested) {
+			return "", newError(CodeForbidden, errors.Errorf("role %s is not granted by the token", requested))
+		}
+	default:
+		return "", newError(CodeBadRequest, errors.Errorf("unknown role %q", requested))
+	}
+
+	return requested, nil
+}
+
+// newRoom is the room stored when the first participant or device arrives.
+// Rooms are 1:1 calls unless created as a group.
+func (a *App) newRoom(name string, token string, roomType string) (*internalrooms.Room, error) {
+	r := &internalrooms.Room{
+		Name:            name,
+		Token:           token,
+		Observer:        a.observers,
+		SpeakerConfig:   a.speakers,
+		RingTimeout:     a.ringTimeout,
+		ChatConfig:      a.chat,
+		ReactionConfig:  a.reactions,
+		MaxScreenShares: a.maxScreenShares,
+	}
+
+	switch roomType {
+	case "", internalrooms.DirectType:
+		r.Type = internalrooms.DirectType
+		r.MaxParticipants = 2
+	case internalrooms.GroupType:
+		r.Type = internalrooms.GroupType
+		r.MaxParticipants = a.maxParticipants
+	default:
+		return nil, newError(CodeBadRequest, errors.Errorf("unknown room type %q", roomType))
+	}
+
+	return r, nil
+}
+
+// invite adds the invitations of the participant to the room and rings
+// the newly invited users through push notifications.
+func (a *App) invite(
+	ctx context.Context,
+	r *internalrooms.Room,
+	p *internalrooms.Participant,
+	participants []*internalrooms.InvitedParticipant,
+) error {
+	var rung []int64
+	for _, value := range participants {
+		invitedPeer := &internalrooms.InvitedParticipant{
+			Room:      r,
+			UserID:    value.UserID,
+			FirstName: value.FirstName,
+			LastName:  value.LastName,
+			Status:    value.Status,
+			Photo:     value.Photo,
+			InvitedBy: p.UserID,
+		}
+		invited, err := r.AddInvited(invitedPeer)
+		if err != nil {
+			return err
+		}
+
+		if invited {
+			rung = append(rung, invitedPeer.UserID)
+		}
+
+		logger.Tf(ctx, "InviteUser %v ok", invitedPeer)
+	}
+
+	a.pusher.Ring(ctx, r, p, rung)
+
+	return nil
+}
+
+// abandon removes a participant whose join failed after it was added,
+// nobody was told about it yet.
+func (a *App) abandon(r *internalrooms.Room, p *internalrooms.Participant) {
+	if r.Remove(p) && r.IsEmpty() {
+		// The room may have been created for the participant alone.
+		go func() {
+			a.emptyRooms <- r.Name
+		}()
+	}
+}
+
+// authorize rejects actions on behalf of anyone but the authenticated user.
+func (a *App) authorize(s *session, room string, userID int64) error {
+	if a.verifier == nil {
+		return nil
+	}
+
+	if s.userID == 0 || s.userID != userID {
+		return newError(CodeUnauthorized, errors.Errorf("user %d is not authenticated", userID))
+	}
+
+	// A token only grants the room it was issued for.
+	if !s.rooms[room] {
+		return newError(CodeUnauthorized, errors.Errorf("user %d is not authenticated for room %s", userID, room))
+	}
+
+	return nil
+}
+
+// roomToken is the shared secret stored on a new room. Signed tokens are
+// issued per user, so rooms are not bound to one of them.
+func (a *App) roomToken(token string) string {
+	if a.verifier != nil {
+		return ""
+	}
+
+	return token
+}
+
+func (a *App) observeMediaServer(endpoint string, start time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+
+	a.metrics.MediaServerDuration.WithLabelValues(endpoint, result).Observe(time.Since(start).Seconds())
+}
+
+func newResumeToken() (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(token), nil
+}
+
+// handleRelay forwards the offer, answer and iceCandidate actions of P2P
+// rooms to the target participant.
+func handleRelay(
+	ctx context.Context,
+	a *App,
+	s *session,
+	m []byte,
+	action Action,
+) (interface{}, error) {
+	obj := EventRelay{}
+	if err := json.Unmarshal(m, &obj); err != nil {
+		return nil, errors.Wrapf(err, "Unmarshal %s", m)
+	}
+
+	if err := a.authorize(s, obj.Message.Room, obj.Message.UserID); err != nil {
+		return nil, err
+	}
+
+	event := action.Message.Action
+	if event == "iceCandidate" && len(obj.Message.Candidate) == 0 ||
+		event != "iceCandidate" && obj.Message.SDP == "" {
+		return nil, newError(CodeBadRequest, errors.Errorf("%s without payload", event))
+	}
+
+	if obj.Message.TargetUserID == obj.Message.UserID {
+		return nil, newError(CodeBadRequest, errors.Errorf("%s to self", event))
+	}
+
+	r, loaded := a.rooms.Load(ctx, obj.Message.Room)
+	if !loaded {
+		return nil, newError(CodeRoomNotFound, errors.Errorf("room %s does not exist", obj.Message.Room))
+	}
+
+	if !r.IsP2P() {
+		return nil, newError(CodeForbidden, errors.Errorf("room %s is not in p2p mode", r.Name))
+	}
+
+	if _, err := r.Get(obj.Message.UserID); err != nil {
+		return nil, errors.Wrapf(err, "%s", event)
+	}
+
+	err := r.Relay(ctx, obj.Message.UserID, obj.Message.TargetUserID, event, obj.Message.SDP, obj.Message.Candidate)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s", event)
+	}
+
+	return nil, nil
+}
+
+// handleChat sends a text message to the room or to one participant, the
+// response carries the message with its id and time.
+func handleChat(
+	ctx context.Context,
+	a *App,
+	s *session,
+	m []byte,
+	action Action,
+) (interface{}, error) {
+	obj := EventChat{}
+	if err := json.Unmarshal(m, &obj); err != nil {
+		return nil, errors.Wrapf(err, "Unmarshal %s", m)
+	}
+
+	if err := a.authorize(s, obj.Message.Room, obj.Message.UserID); err != nil {
+		return nil, err
+	}
+
+	if obj.Message.Text == "" {
+		return nil, newError(CodeBadRequest, errors.Errorf("chat without text"))
+	}
+
+	if obj.Message.TargetUserID == obj.Message.UserID {
+		return nil, newError(CodeBadRequest, errors.Errorf("chat to self"))
+	}
+
+	r, loaded := a.rooms.Load(ctx, obj.Message.Room)
+	if !loaded {
+		return nil, newError(CodeRoomNotFound, errors.Errorf("room %s does not exist", obj.Message.Room))
+	}
+
+	if _, err := r.Get(obj.Message.UserID); err != nil {
+		return nil, errors.Wrapf(err, "chat")
+	}
+
+	message, err := r.Chat(ctx, obj.Message.UserID, obj.Message.TargetUserID, obj.Message.Text)
+	if err != nil {
+		return nil, errors.Wrapf(err, "chat")
+	}
+
+	return ResponseChat{Action: action.Message.Action, Message: message}, nil
+}
+
+// handleChatAck tells the sender of a message that it was delivered or read.
+func handleChatAck(
+	ctx context.Context,
+	a *App,
+	s *session,
+	m []byte,
+	_ Action,
+) (interface{}, error) {
+	obj := EventChatAck{}
+	if err := json.Unmarshal(m, &obj); err != nil {
+		return nil, errors.Wrapf(err, "Unmarshal %s", m)
+	}
+
+	if err := a.authorize(s, obj.Message.Room, obj.Message.UserID); err != nil {
+		return nil, err
+	}
+
+	status := obj.Message.Status
+	switch status {
+	case "":
+		status = internalrooms.DeliveredReceipt
+	case internalrooms.DeliveredReceipt, internalrooms.ReadReceipt:
+	default:
+		return nil, newError(CodeBadRequest, errors.Errorf("unknown receipt status %q", status))
+	}
+
+	r, loaded := a.rooms.Load(ctx, obj.Message.Room)
+	if !loaded {
+		return nil, newError(CodeRoomNotFound, errors.Errorf("room %s does not exist", obj.Message.Room))
+	}
+
+	if _, err := r.Get(obj.Message.UserID); err != nil {
+		return nil, errors.Wrapf(err, "chatAck")
+	}
+
+	if !r.AckChat(ctx, obj.Message.UserID, obj.Message.MessageID, status) {
+		return nil, newError(CodeBadRequest, errors.Errorf("message %s is not for user %d", obj.Message.MessageID, obj.Message.UserID))
+	}
+
+	return nil, nil
+}
+
+// handleCustom relays an opaque payload of an allowed type to the room or
+// to some participants.
+func handleCustom(
+	ctx context.Context,
+	a *App,
+	s *session,
+	m []byte,
+	_ Action,
+) (interface{}, error) {
+	obj := EventCustom{}
+	if err := json.Unmarshal(m, &obj); err != nil {
+		return nil, errors.Wrapf(err, "Unmarshal %s", m)
+	}
+
+	if err := a.authorize(s, obj.Message.Room, obj.Message.UserID); err != nil {
+		return nil, err
+	}
+
+	if !a.customTypes[obj.Message.Type] {
+		return nil, newError(CodeForbidden, errors.Errorf("custom type %q is not allowed", obj.Message.Type))
+	}
+
+	if a.maxCustomPayload > 0 && len(obj.Message.Payload) > a.maxCustomPayload {
+		return nil, newError(CodeMessageTooLong, errors.Errorf("%s payload of %d bytes", obj.Message.Type, len(obj.Message.Payload)))
+	}
+
+	r, loaded := a.rooms.Load(ctx, obj.Message.Room)
+	if !loaded {
+		return nil, newError(CodeRoomNotFound, errors.Errorf("room %s does not exist", obj.Message.Room))
+	}
+
+	if _, err := r.Get(obj.Message.UserID); err != nil {
+		return nil, errors.Wrapf(err, "custom")
+	}
+
+	err := r.Custom(ctx, obj.Message.UserID, obj.Message.TargetUserIDs, obj.Message.Type, obj.Message.Payload)
+	if err != nil {
+		return nil, errors.Wrapf(err, "custom %s", obj.Message.Type)
+	}
+
+	return nil, nil
+}
+
+// handleHand raises or lowers the hand of a participant, moderators may
+// lower the hands of the others.
+func handleHand(
+	ctx context.Context,
+	a *App,
+	s *session,
+	m []byte,
+	action Action,
+) (interface{}, error) {
+	obj := EventHand{}
+	if err := json.Unmarshal(m, &obj); err != nil {
+		return nil, errors.Wrapf(err, "Unmarshal %s", m)
+	}
+
+	if err := a.authorize(s, obj.Message.Room, obj.Message.UserID); err != nil {
+		return nil, err
+	}
+
+	event := action.Message.Action
+
+	r, loaded := a.rooms.Load(ctx, obj.Message.Room)
+	if !loaded {
+		return nil, newError(CodeRoomNotFound, errors.Errorf("room %s does not exist", obj.Message.Room))
+	}
+
+	p, err := r.Get(obj.Message.UserID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s", event)
+	}
+
+	switch {
+	case event == internalrooms.RaiseHandEvent:
+		go r.RaiseHand(context.Background(), p)
+	case event == internalrooms.LowerAllHandsEvent,
+		event == internalrooms.LowerHandEvent && obj.Message.TargetUserID != 0 && obj.Message.TargetUserID != p.UserID:
+		if !p.IsModerator() {
+			return nil, newError(CodeForbidden, errors.Errorf("user %d can not %s in room %s", p.UserID, event, r.Name))
+		}
+
+		if event == internalrooms.LowerAllHandsEvent {
+			go r.LowerAllHands(context.Background(), p)
+			break
+		}
+
+		target, err := r.Get(obj.Message.TargetUserID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s", event)
+		}
+		go r.LowerHand(context.Background(), target)
+	default:
+		go r.LowerHand(context.Background(), p)
+	}
+
+	return nil, nil
+}
+
+// handleReaction broadcasts an ephemeral reaction of a participant.
+func handleReaction(
+	ctx context.Context,
+	a *App,
+	s *session,
+	m []byte,
+	_ Action,
+) (interface{}, error) {
+	obj := EventReaction{}
+	if err := json.Unmarshal(m, &obj); err != nil {
+		return nil, errors.Wrapf(err, "Unmarshal %s", m)
+	}
+
+	if err := a.authorize(s, obj.Message.Room, obj.Message.UserID); err != nil {
+		return nil, err
+	}
+
+	if obj.Message.Reaction == "" {
+		return nil, newError(CodeBadRequest, errors.Errorf("reaction without emoji"))
+	}
+
+	r, loaded := a.rooms.Load(ctx, obj.Message.Room)
+	if !loaded {
+		return nil, newError(CodeRoomNotFound, errors.Errorf("room %s does not exist", obj.Message.Room))
+	}
+
+	if _, err := r.Get(obj.Message.UserID); err != nil {
+		return nil, errors.Wrapf(err, "reaction")
+	}
+
+	if err := r.React(ctx, obj.Message.UserID, obj.Message.Reaction); err != nil {
+		return nil, errors.Wrapf(err, "reaction")
+	}
+
+	return nil, nil
+}
+
+// handleICEServers renews the ICE servers credentials of a participant.
+func handleICEServers(
+	ctx context.Context,
+	a *App,
+	s *session,
+	m []byte,
+	action Action,
+) (interface{}, error) {
+	obj := EventICEServers{}
+	if err := json.Unmarshal(m, &obj); err != nil {
+		return nil, errors.Wrapf(err, "Unmarshal %s", m)
+	}
+
+	if err := a.authorize(s, obj.Message.Room, obj.Message.UserID); err != nil {
+		return nil, err
+	}
+
+	r, loaded := a.rooms.Load(ctx, obj.Message.Room)
+	if !loaded {
+		return nil, newError(CodeRoomNotFound, errors.Errorf("room %s does not exist", obj.Message.Room))
+	}
+
+	p, err := r.Get(obj.Message.UserID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "iceServers")
+	}
+
+	return ResponseICEServers{
+		Action:     action.Message.Action,
+		IceServers: a.iceServers.For(p.UserID),
+		TTL:        int64(a.iceServers.TTL().Seconds()),
+	}, nil
+}
+
+// handleModerate runs the moderator actions: muteParticipant, disableCamera
+// and removeParticipant act on the target, muteAll, lockRoom and unlockRoom
+// on the whole room.
+func handleModerate(
+	ctx context.Context,
+	a *App,
+	s *session,
+	m []byte,
+	action Action,
+) (interface{}, error) {
+	obj := EventModerate{}
+	if err := json.Unmarshal(m, &obj); err != nil {
+		return nil, errors.Wrapf(err, "Unmarshal %s", m)
+	}
+
+	if err := a.authorize(s, obj.Message.Room, obj.Message.UserID); err != nil {
+		return nil, err
+	}
+
+	event := action.Message.Action
+
+	r, loaded := a.rooms.Load(ctx, obj.Message.Room)
+	if !loaded {
+		return nil, newError(CodeRoomNotFound, errors.Errorf("room %s does not exist", obj.Message.Room))
+	}
+
+	moderator, err := r.Get(obj.Message.UserID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s", event)
+	}
+
+	if !moderator.IsModerator() {
+		return nil, newError(CodeForbidden, errors.Errorf("user %d can not moderate room %s", moderator.UserID, r.Name))
+	}
+
+	switch event {
+	case internalrooms.MuteAllEvent:
+		go r.MuteAll(context.Background())
+		return nil, nil
+	case internalrooms.LockRoomEvent, internalrooms.UnlockRoomEvent:
+		go r.SetLocked(context.Background(), event == internalrooms.LockRoomEvent, moderator.UserID)
+		return nil, nil
+	}
+
+	target, err := r.Get(obj.Message.TargetUserID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s", event)
+	}
+
+	if target.UserID == moderator.UserID ||
+		target.Role == internalrooms.HostRole && moderator.Role != internalrooms.HostRole {
+		return nil, newError(CodeForbidden, errors.Errorf("user %d can not %s %d", moderator.UserID, event, target.UserID))
+	}
+
+	logger.Tf(ctx, "%s %v by %d", event, target, moderator.UserID)
+
+	switch event {
+	case internalrooms.MuteParticipantEvent:
+		go r.Mute(context.Background(), target, event)
+	case internalrooms.DisableCameraEvent:
+		go r.DisableCamera(context.Background(), target)
+	case internalrooms.RemoveParticipantEvent:
+		go r.RemoveParticipant(context.Background(), target.UserID, moderator.UserID)
+	}
+
+	return nil, nil
 }
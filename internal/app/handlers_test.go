@@ -0,0 +1,139 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+	internalrooms "signal/internal/rooms"
+)
+
+func TestHandlersAuthorization(t *testing.T) {
+	ctx := context.Background()
+
+	verifier, err := NewJWTVerifier("secret", "")
+	require.NoError(t, err)
+	a := New(nil, "srs", WithTokenVerifier(verifier))
+
+	preconnect := func(s *session, room string, userID int64, deviceID string) {
+		m, err := json.Marshal(map[string]any{"msg": map[string]any{
+			"action":   "preconnect",
+			"room":     room,
+			"token":    signToken(t, room, userID),
+			"userId":   userID,
+			"deviceId": deviceID,
+		}})
+		require.NoError(t, err)
+
+		_, err = handlePreconnect(ctx, a, s, m, Action{}, internalrooms.NewQueue(internalrooms.QueueConfig{}, nil))
+		require.NoError(t, err)
+	}
+
+	bob, carol, mallory := &session{}, &session{}, &session{}
+	preconnect(bob, "call", 2, "bob-phone")
+	preconnect(carol, "call", 3, "carol-phone")
+	preconnect(mallory, "other", 4, "mallory-phone")
+
+	for _, action := range []string{"accept", "decline", "busy"} {
+		t.Run(action, func(t *testing.T) {
+			// Another user of the room answers for bob's phone.
+			err := handle(ctx, a, carol, action, "call", 3, "bob-phone")
+			require.Equal(t, CodeDeviceNotFound, asError(err).Code)
+
+			// A user of another room claims to be bob.
+			err = handle(ctx, a, mallory, action, "call", 2, "bob-phone")
+			require.Equal(t, CodeUnauthorized, asError(err).Code)
+
+			// A user of another room answers in its own name.
+			err = handle(ctx, a, mallory, action, "call", 4, "bob-phone")
+			require.Equal(t, CodeUnauthorized, asError(err).Code)
+		})
+	}
+
+	r, loaded := a.rooms.Load(ctx, "call")
+	require.True(t, loaded)
+	require.Equal(t, internalrooms.RingingCallState, r.CallState(2).State)
+
+	require.NoError(t, handle(ctx, a, bob, "accept", "call", 2, "bob-phone"))
+	require.Equal(t, internalrooms.AcceptedCallState, r.CallState(2).State)
+}
+
+func TestHandlersResumeAuthorization(t *testing.T) {
+	ctx := context.Background()
+
+	verifier, err := NewJWTVerifier("secret", "")
+	require.NoError(t, err)
+	a := New(nil, "srs", WithTokenVerifier(verifier), WithResumeGracePeriod(time.Minute))
+
+	m, err := json.Marshal(map[string]any{"msg": map[string]any{
+		"action": "join",
+		"room":   "call",
+		"token":  signToken(t, "call", 1),
+		"userId": 1,
+	}})
+	require.NoError(t, err)
+
+	connCtx, drop := context.WithCancel(ctx)
+	res, err := handleJoin(connCtx, a, &session{}, m, Action{}, internalrooms.NewQueue(internalrooms.QueueConfig{}, nil))
+	require.NoError(t, err)
+	join := res.(ResponseJoin)
+
+	// The connection drops and the participant waits for a resume.
+	drop()
+
+	m, err = json.Marshal(map[string]any{"msg": map[string]any{
+		"action":      "resume",
+		"room":        "call",
+		"userId":      1,
+		"resumeToken": join.ResumeToken,
+	}})
+	require.NoError(t, err)
+
+	s := &session{}
+	require.Eventually(t, func() bool {
+		_, err := handleResume(ctx, a, s, m, Action{}, internalrooms.NewQueue(internalrooms.QueueConfig{}, nil))
+		return err == nil
+	}, time.Second, time.Millisecond)
+
+	// The resumed connection acts in the room without a new token.
+	require.NoError(t, handle(ctx, a, s, "ready", "call", 1, ""))
+	require.Equal(t, CodeUnauthorized, asError(handle(ctx, a, s, "ready", "other", 1, "")).Code)
+}
+
+// signToken signs a token granting userID the room.
+func signToken(t *testing.T, room string, userID int64) string {
+	claims := TokenClaims{
+		Room:   room,
+		UserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+	require.NoError(t, err)
+
+	return token
+}
+
+// handle runs the handler of action as the session would.
+func handle(ctx context.Context, a *App, s *session, action string, room string, userID int64, deviceID string) error {
+	m, err := json.Marshal(map[string]any{"msg": map[string]any{
+		"action":   action,
+		"room":     room,
+		"userId":   userID,
+		"deviceId": deviceID,
+	}})
+	if err != nil {
+		return err
+	}
+
+	act := Action{}
+	act.Message.Action = action
+	_, err = handlers[action](ctx, a, s, m, act)
+
+	return err
+}
@@ -0,0 +1,407 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ossrs/go-oryx-lib/logger"
+	internalrooms "signal/internal/rooms"
+)
+
+const (
+	// JoinedInviteOutcome and the other outcomes complete the invite
+	// statuses of the rooms package once the invitation is over.
+	JoinedInviteOutcome    string = "joined"
+	CancelledInviteOutcome string = "cancelled"
+	MissedInviteOutcome    string = "missed"
+
+	// maxMemoryCallRecords bounds the memory call history.
+	maxMemoryCallRecords = 1000
+)
+
+// CallRecord is the detail record of a call, saved once the call is over.
+// Times are unix seconds.
+type CallRecord struct {
+	ID           string             `json:"id"`
+	Room         string             `json:"room"`
+	InitiatorID  int64              `json:"initiatorId,omitempty"`
+	CreatedAt    int64              `json:"createdAt"`
+	StartedAt    *int64             `json:"startedAt,omitempty"`
+	EndedAt      int64              `json:"endedAt"`
+	EndedBy      int64              `json:"endedBy,omitempty"`
+	EndReason    string             `json:"endReason"`
+	Participants []CallParticipant  `json:"participants"`
+	Invitations  []CallInvitation   `json:"invitations"`
+	Devices      []CallDeviceAnswer `json:"devices"`
+}
+
+// CallParticipant is one stay of a user in the call, a user who rejoined
+// has several.
+type CallParticipant struct {
+	UserID   int64 `json:"userId"`
+	JoinedAt int64 `json:"joinedAt"`
+	LeftAt   int64 `json:"leftAt"`
+}
+
+// CallInvitation is the last known status of the invitation of a user.
+type CallInvitation struct {
+	UserID    int64  `json:"userId"`
+	InvitedAt int64  `json:"invitedAt"`
+	Status    string `json:"status"`
+}
+
+// CallDeviceAnswer is a preconnect answer of a device.
+type CallDeviceAnswer struct {
+	UserID   int64  `json:"userId"`
+	DeviceID string `json:"deviceId"`
+	Status   string `json:"status"`
+	At       int64  `json:"at"`
+}
+
+// CallHistoryQuery selects the calls created in [From, To) the user took
+// part in, was invited to or initiated. Zero values match everything.
+type CallHistoryQuery struct {
+	UserID int64
+	From   time.Time
+	To     time.Time
+	Limit  int
+}
+
+// CallHistoryStore keeps the call detail records.
+type CallHistoryStore interface {
+	Save(ctx context.Context, record CallRecord) error
+	// Query returns the matching records, newest first.
+	Query(ctx context.Context, query CallHistoryQuery) ([]CallRecord, error)
+}
+
+func (q CallHistoryQuery) match(record CallRecord) bool {
+	if !q.From.IsZero() && record.CreatedAt < q.From.Unix() {
+		return false
+	}
+	if !q.To.IsZero() && record.CreatedAt >= q.To.Unix() {
+		return false
+	}
+
+	return q.UserID == 0 || record.involves(q.UserID)
+}
+
+// sort orders the records newest first and applies the limit.
+func (q CallHistoryQuery) sort(records []CallRecord) []CallRecord {
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].CreatedAt > records[j].CreatedAt
+	})
+
+	if q.Limit > 0 && len(records) > q.Limit {
+		records = records[:q.Limit]
+	}
+
+	return records
+}
+
+func (c *CallRecord) involves(userID int64) bool {
+	if c.InitiatorID == userID {
+		return true
+	}
+	for _, participant := range c.Participants {
+		if participant.UserID == userID {
+			return true
+		}
+	}
+	for _, invitation := range c.Invitations {
+		if invitation.UserID == userID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *CallRecord) invitation(userID int64) *CallInvitation {
+	for i := range c.Invitations {
+		if c.Invitations[i].UserID == userID {
+			return &c.Invitations[i]
+		}
+	}
+
+	return nil
+}
+
+// inviteAll records the invitations still listed by the room.
+func (c *CallRecord) inviteAll(invitedParticipants []*internalrooms.InvitedParticipant, now int64) {
+	for _, invited := range invitedParticipants {
+		status := invited.InviteStatus
+		if status == "" {
+			status = internalrooms.InvitePending
+		}
+
+		if invitation := c.invitation(invited.UserID); invitation != nil {
+			invitation.Status = status
+			continue
+		}
+
+		c.Invitations = append(c.Invitations, CallInvitation{UserID: invited.UserID, InvitedAt: now, Status: status})
+	}
+}
+
+func (c *CallRecord) join(userID int64, now int64) {
+	for _, participant := range c.Participants {
+		if participant.UserID == userID && participant.LeftAt == 0 {
+			return
+		}
+	}
+
+	c.Participants = append(c.Participants, CallParticipant{UserID: userID, JoinedAt: now})
+
+	if invitation := c.invitation(userID); invitation != nil {
+		invitation.Status = JoinedInviteOutcome
+	}
+}
+
+func (c *CallRecord) leave(userID int64, now int64) {
+	for i := range c.Participants {
+		if c.Participants[i].UserID == userID && c.Participants[i].LeftAt == 0 {
+			c.Participants[i].LeftAt = now
+		}
+	}
+}
+
+// end closes the stays and the invitations left open.
+func (c *CallRecord) end(userID int64, reason string, now int64) {
+	c.EndedAt, c.EndedBy, c.EndReason = now, userID, reason
+
+	for i := range c.Participants {
+		if c.Participants[i].LeftAt == 0 {
+			c.Participants[i].LeftAt = now
+		}
+	}
+
+	for i := range c.Invitations {
+		switch c.Invitations[i].Status {
+		case internalrooms.InvitePending, internalrooms.InviteRinging:
+			c.Invitations[i].Status = MissedInviteOutcome
+		}
+	}
+}
+
+// CallRecorder builds the call detail records from the room events and
+// saves them once the call ended or the room is empty. It only sees the
+// events of this instance, so it suits a single node.
+type CallRecorder struct {
+	store CallHistoryStore
+
+	mu    sync.Mutex
+	calls map[string]*CallRecord
+}
+
+func NewCallRecorder(store CallHistoryStore) *CallRecorder {
+	return &CallRecorder{
+		store: store,
+		calls: map[string]*CallRecord{},
+	}
+}
+
+func (c *CallRecorder) Observe(ctx context.Context, e internalrooms.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now().Unix()
+
+	record, ok := c.calls[e.Room]
+	if !ok {
+		// A call begins with a join or an answer, the other events belong
+		// to a call already saved or to a room nobody joined, which would
+		// never see an end to save it.
+		switch {
+		case e.Kind == internalrooms.NotifyKind && e.Event == "join":
+		case e.Kind == internalrooms.StartKind:
+		default:
+			return
+		}
+
+		record = &CallRecord{ID: newCallID(), Room: e.Room, CreatedAt: now}
+		c.calls[e.Room] = record
+	}
+
+	switch e.Kind {
+	case internalrooms.NotifyKind:
+		if e.InitiatorID != 0 {
+			record.InitiatorID = e.InitiatorID
+		}
+		if e.StartedAt != nil {
+			record.StartedAt = e.StartedAt
+		}
+		record.inviteAll(e.InvitedParticipants, now)
+
+		if e.Peer == nil {
+			return
+		}
+		switch e.Event {
+		case "join":
+			record.join(e.Peer.UserID, now)
+		case "leave":
+			record.leave(e.Peer.UserID, now)
+		}
+	case internalrooms.InviteKind:
+		record.inviteAll(e.InvitedParticipants, now)
+		if e.Event == internalrooms.CancelInviteEvent {
+			if invitation := record.invitation(e.UserID); invitation != nil {
+				invitation.Status = CancelledInviteOutcome
+			}
+		}
+	case internalrooms.PreconnectKind:
+		if e.Device == nil {
+			return
+		}
+		record.Devices = append(record.Devices, CallDeviceAnswer{
+			UserID:   e.Device.UserID,
+			DeviceID: e.Device.ID,
+			Status:   e.Event,
+			At:       now,
+		})
+	case internalrooms.StartKind:
+		record.StartedAt = e.StartedAt
+	case internalrooms.EndKind:
+		record.end(e.UserID, e.Reason, now)
+		c.save(ctx, record)
+	case internalrooms.EmptyKind:
+		record.end(0, internalrooms.EmptyReason, now)
+		c.save(ctx, record)
+	}
+}
+
+// save hands the record over to the store without blocking the room.
+func (c *CallRecorder) save(ctx context.Context, record *CallRecord) {
+	delete(c.calls, record.Room)
+
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		if err := c.store.Save(ctx, *record); err != nil {
+			logger.Wf(ctx, "Save call %v of %v err %v", record.ID, record.Room, err)
+		}
+	}()
+}
+
+// MemoryCallHistoryStore keeps the most recent records in memory, it is
+// meant for tests and local development.
+type MemoryCallHistoryStore struct {
+	mu      sync.Mutex
+	records []CallRecord
+}
+
+func NewMemoryCallHistoryStore() *MemoryCallHistoryStore {
+	return &MemoryCallHistoryStore{}
+}
+
+func (s *MemoryCallHistoryStore) Save(_ context.Context, record CallRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.records) == maxMemoryCallRecords {
+		s.records = s.records[1:]
+	}
+	s.records = append(s.records, record)
+
+	return nil
+}
+
+func (s *MemoryCallHistoryStore) Query(_ context.Context, query CallHistoryQuery) ([]CallRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := make([]CallRecord, 0)
+	for _, record := range s.records {
+		if query.match(record) {
+			records = append(records, record)
+		}
+	}
+
+	return query.sort(records), nil
+}
+
+// MarshalCallRecordsCSV exports the records one call per row. The
+// participants, invitations and devices columns hold ";" separated lists.
+func MarshalCallRecordsCSV(records []CallRecord) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w := csv.NewWriter(buf)
+
+	rows := [][]string{{
+		"id", "room", "initiatorId", "createdAt", "startedAt", "endedAt", "duration",
+		"endedBy", "endReason", "participants", "invitations", "devices",
+	}}
+
+	for _, record := range records {
+		var duration, startedAt string
+		if record.StartedAt != nil {
+			startedAt = csvTime(*record.StartedAt)
+			duration = strconv.FormatInt(record.EndedAt-*record.StartedAt, 10)
+		}
+
+		participants := make([]string, 0, len(record.Participants))
+		for _, p := range record.Participants {
+			participants = append(participants, fmt.Sprintf("%d %s/%s", p.UserID, csvTime(p.JoinedAt), csvTime(p.LeftAt)))
+		}
+
+		invitations := make([]string, 0, len(record.Invitations))
+		for _, invitation := range record.Invitations {
+			invitations = append(invitations, fmt.Sprintf("%d %s", invitation.UserID, invitation.Status))
+		}
+
+		devices := make([]string, 0, len(record.Devices))
+		for _, d := range record.Devices {
+			devices = append(devices, fmt.Sprintf("%d %s %s %s", d.UserID, d.DeviceID, d.Status, csvTime(d.At)))
+		}
+
+		rows = append(rows, []string{
+			record.ID,
+			record.Room,
+			csvUserID(record.InitiatorID),
+			csvTime(record.CreatedAt),
+			startedAt,
+			csvTime(record.EndedAt),
+			duration,
+			csvUserID(record.EndedBy),
+			record.EndReason,
+			strings.Join(participants, ";"),
+			strings.Join(invitations, ";"),
+			strings.Join(devices, ";"),
+		})
+	}
+
+	if err := w.WriteAll(rows); err != nil {
+		return nil, fmt.Errorf("write csv: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func csvTime(unix int64) string {
+	if unix == 0 {
+		return ""
+	}
+
+	return time.Unix(unix, 0).UTC().Format(time.RFC3339)
+}
+
+func csvUserID(userID int64) string {
+	if userID == 0 {
+		return ""
+	}
+
+	return strconv.FormatInt(userID, 10)
+}
+
+func newCallID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,125 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/ossrs/go-oryx-lib/logger"
+)
+
+// FileCallHistoryStore appends the records to a JSON lines file, queries
+// scan the whole file. It suits a single node keeping its own history.
+type FileCallHistoryStore struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewFileCallHistoryStore(path string) (*FileCallHistoryStore, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open call history: %w", err)
+	}
+
+	if err := terminateLastLine(file); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("repair call history: %w", err)
+	}
+
+	return &FileCallHistoryStore{path: path, file: file}, nil
+}
+
+// terminateLastLine ends a record cut short by a crash with a newline, so
+// the records saved afterwards do not run into it.
+func terminateLastLine(file *os.File) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return nil
+	}
+
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, info.Size()-1); err != nil {
+		return err
+	}
+	if last[0] == '\n' {
+		return nil
+	}
+
+	_, err = file.Write([]byte{'\n'})
+	return err
+}
+
+func (s *FileCallHistoryStore) Save(_ context.Context, record CallRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("marshal call %v: %w", record.ID, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write call %v: %w", record.ID, err)
+	}
+
+	return nil
+}
+
+func (s *FileCallHistoryStore) Query(ctx context.Context, query CallHistoryQuery) ([]CallRecord, error) {
+	s.mu.Lock()
+	file, err := os.Open(s.path)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("open call history: %w", err)
+	}
+	defer file.Close()
+
+	records := make([]CallRecord, 0)
+	reader := bufio.NewReader(file)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		line, err := reader.ReadBytes('\n')
+		if err != nil && !stderrors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("read call history: %w", err)
+		}
+		if len(line) == 0 {
+			break
+		}
+
+		// A record cut short by a crash, or still being written at the
+		// end of the file, is lost but does not hide the others.
+		record := CallRecord{}
+		if decodeErr := json.Unmarshal(line, &record); decodeErr != nil {
+			logger.Wf(ctx, "Skip call history line err %v", decodeErr)
+		} else if query.match(record) {
+			records = append(records, record)
+		}
+
+		if err != nil {
+			break
+		}
+	}
+
+	return query.sort(records), nil
+}
+
+// Close closes the file, the store can not be used afterwards.
+func (s *FileCallHistoryStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
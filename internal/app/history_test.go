@@ -0,0 +1,192 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	internalrooms "signal/internal/rooms"
+)
+
+func TestCallRecorder(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryCallHistoryStore()
+	recorder := NewCallRecorder(store)
+
+	invited := func(userID int64, status string) []*internalrooms.InvitedParticipant {
+		return []*internalrooms.InvitedParticipant{{UserID: userID, InviteStatus: status}}
+	}
+
+	startedAt := time.Now().Unix()
+	for _, e := range []internalrooms.Event{
+		{Kind: internalrooms.NotifyKind, Event: "join", Peer: &internalrooms.Participant{UserID: 1}, InitiatorID: 1},
+		{Kind: internalrooms.NotifyKind, Event: "join", Peer: &internalrooms.Participant{UserID: 1}, InvitedParticipants: invited(2, internalrooms.InvitePending)},
+		{Kind: internalrooms.InviteKind, Event: internalrooms.InviteStatusEvent, UserID: 2, InvitedParticipants: invited(2, internalrooms.InviteRinging)},
+		{Kind: internalrooms.PreconnectKind, Event: internalrooms.AcceptStatus, Device: &internalrooms.Device{UserID: 2, ID: "phone"}},
+		{Kind: internalrooms.StartKind, UserID: 2, StartedAt: &startedAt},
+		{Kind: internalrooms.NotifyKind, Event: "join", Peer: &internalrooms.Participant{UserID: 2}, StartedAt: &startedAt},
+		{Kind: internalrooms.InviteKind, Event: internalrooms.InviteStatusEvent, UserID: 3, InvitedParticipants: invited(3, internalrooms.InviteRinging)},
+		{Kind: internalrooms.InviteKind, Event: internalrooms.CancelInviteEvent, UserID: 3},
+		{Kind: internalrooms.InviteKind, Event: internalrooms.InviteStatusEvent, UserID: 4, InvitedParticipants: invited(4, internalrooms.InviteRinging)},
+		{Kind: internalrooms.NotifyKind, Event: "leave", Peer: &internalrooms.Participant{UserID: 1}},
+		{Kind: internalrooms.EndKind, UserID: 2, Reason: internalrooms.HangupReason},
+		// The call is saved, the room only reports its end.
+		{Kind: internalrooms.NotifyKind, Event: "leave", Peer: &internalrooms.Participant{UserID: 2}},
+		{Kind: internalrooms.EmptyKind},
+	} {
+		e.Room = "call"
+		recorder.Observe(ctx, e)
+	}
+
+	var records []CallRecord
+	require.Eventually(t, func() bool {
+		records, _ = store.Query(ctx, CallHistoryQuery{})
+		return len(records) == 1
+	}, time.Second, time.Millisecond)
+
+	record := records[0]
+	require.NotEmpty(t, record.ID)
+	require.Equal(t, "call", record.Room)
+	require.Equal(t, int64(1), record.InitiatorID)
+	require.Equal(t, &startedAt, record.StartedAt)
+	require.NotZero(t, record.EndedAt)
+	require.Equal(t, int64(2), record.EndedBy)
+	require.Equal(t, internalrooms.HangupReason, record.EndReason)
+
+	require.Len(t, record.Participants, 2)
+	for _, participant := range record.Participants {
+		require.NotZero(t, participant.LeftAt)
+	}
+
+	statuses := map[int64]string{}
+	for _, invitation := range record.Invitations {
+		statuses[invitation.UserID] = invitation.Status
+	}
+	require.Equal(t, map[int64]string{
+		2: JoinedInviteOutcome,
+		3: CancelledInviteOutcome,
+		4: MissedInviteOutcome,
+	}, statuses)
+
+	require.Equal(t, []CallDeviceAnswer{{UserID: 2, DeviceID: "phone", Status: internalrooms.AcceptStatus, At: record.Devices[0].At}}, record.Devices)
+
+	// A room nobody joined is not a call, even when its devices rang.
+	for _, e := range []internalrooms.Event{
+		{Kind: internalrooms.InviteKind, Event: internalrooms.InviteStatusEvent, UserID: 2, InvitedParticipants: invited(2, internalrooms.InviteRinging)},
+		{Kind: internalrooms.PreconnectKind, Event: internalrooms.DeclineStatus, Device: &internalrooms.Device{UserID: 2, ID: "phone"}},
+		{Kind: internalrooms.EmptyKind},
+	} {
+		e.Room = "other"
+		recorder.Observe(ctx, e)
+	}
+	time.Sleep(10 * time.Millisecond)
+	records, err := store.Query(ctx, CallHistoryQuery{})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Empty(t, recorder.calls)
+}
+
+func TestCallHistoryStores(t *testing.T) {
+	ctx := context.Background()
+
+	file, err := NewFileCallHistoryStore(filepath.Join(t.TempDir(), "calls.jsonl"))
+	require.NoError(t, err)
+	defer file.Close()
+
+	stores := map[string]CallHistoryStore{
+		"memory": NewMemoryCallHistoryStore(),
+		"file":   file,
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			for _, record := range []CallRecord{
+				{ID: "a", Room: "a", CreatedAt: 100, InitiatorID: 1, Participants: []CallParticipant{{UserID: 2}}},
+				{ID: "b", Room: "b", CreatedAt: 200, InitiatorID: 2, Invitations: []CallInvitation{{UserID: 1}}},
+				{ID: "c", Room: "c", CreatedAt: 300, InitiatorID: 3},
+			} {
+				require.NoError(t, store.Save(ctx, record))
+			}
+
+			ids := func(query CallHistoryQuery) []string {
+				records, err := store.Query(ctx, query)
+				require.NoError(t, err)
+
+				ids := make([]string, 0, len(records))
+				for _, record := range records {
+					ids = append(ids, record.ID)
+				}
+				return ids
+			}
+
+			require.Equal(t, []string{"c", "b", "a"}, ids(CallHistoryQuery{}))
+			require.Equal(t, []string{"b", "a"}, ids(CallHistoryQuery{UserID: 1}))
+			require.Equal(t, []string{"b", "a"}, ids(CallHistoryQuery{UserID: 2}))
+			require.Equal(t, []string{"b"}, ids(CallHistoryQuery{From: time.Unix(200, 0), To: time.Unix(300, 0)}))
+			require.Equal(t, []string{"c"}, ids(CallHistoryQuery{Limit: 1}))
+		})
+	}
+}
+
+func TestMarshalCallRecordsCSV(t *testing.T) {
+	startedAt := int64(1700000010)
+	body, err := MarshalCallRecordsCSV([]CallRecord{{
+		ID:           "a",
+		Room:         "call",
+		InitiatorID:  1,
+		CreatedAt:    1700000000,
+		StartedAt:    &startedAt,
+		EndedAt:      1700000070,
+		EndReason:    internalrooms.HangupReason,
+		Participants: []CallParticipant{{UserID: 1, JoinedAt: 1700000000, LeftAt: 1700000070}},
+		Invitations:  []CallInvitation{{UserID: 2, Status: JoinedInviteOutcome}, {UserID: 3, Status: internalrooms.InviteDeclined}},
+	}})
+	require.NoError(t, err)
+
+	rows, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	require.Equal(t, []string{
+		"a", "call", "1", "2023-11-14T22:13:20Z", "2023-11-14T22:13:30Z", "2023-11-14T22:14:30Z", "60",
+		"", "hangup", "1 2023-11-14T22:13:20Z/2023-11-14T22:14:30Z", "2 joined;3 declined", "",
+	}, rows[1])
+}
+
+func TestFileCallHistoryStoreTornLine(t *testing.T) {
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "calls.jsonl")
+	store, err := NewFileCallHistoryStore(path)
+	require.NoError(t, err)
+
+	require.NoError(t, store.Save(ctx, CallRecord{ID: "a", Room: "a", CreatedAt: 100}))
+
+	// A record still being written when the instance crashed.
+	_, err = store.file.Write([]byte(`{"id":"b","room":`))
+	require.NoError(t, err)
+
+	ids := func(store *FileCallHistoryStore) []string {
+		records, err := store.Query(ctx, CallHistoryQuery{})
+		require.NoError(t, err)
+
+		ids := make([]string, 0, len(records))
+		for _, record := range records {
+			ids = append(ids, record.ID)
+		}
+		return ids
+	}
+	require.Equal(t, []string{"a"}, ids(store))
+	require.NoError(t, store.Close())
+
+	// The restarted instance keeps saving after the torn record.
+	store, err = NewFileCallHistoryStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.NoError(t, store.Save(ctx, CallRecord{ID: "c", Room: "c", CreatedAt: 300}))
+	require.Equal(t, []string{"c", "a"}, ids(store))
+}
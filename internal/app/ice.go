@@ -0,0 +1,74 @@
+package app
+
+import (
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec
+	"encoding/base64"
+	"strconv"
+	"time"
+)
+
+// ICEConfig lists the STUN and TURN servers given to the clients. TURN
+// credentials follow the TURN REST API: the username is "expiry:userId"
+// and the password is the base64 HMAC-SHA1 of the username keyed with
+// Secret, the static-auth-secret of the TURN server.
+type ICEConfig struct {
+	STUNURLs []string
+	TURNURLs []string
+	Secret   string
+	TTL      time.Duration
+}
+
+type ICEServer struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+}
+
+// ICEServers issues the ICE servers with time-limited TURN credentials.
+type ICEServers struct {
+	config ICEConfig
+	now    func() time.Time
+}
+
+func NewICEServers(config ICEConfig) *ICEServers {
+	if config.TTL <= 0 {
+		config.TTL = 24 * time.Hour
+	}
+
+	return &ICEServers{config: config, now: time.Now}
+}
+
+// TTL is how long the issued credentials stay valid.
+func (s *ICEServers) TTL() time.Duration {
+	return s.config.TTL
+}
+
+// For returns the ICE servers with credentials bound to userID.
+func (s *ICEServers) For(userID int64) []ICEServer {
+	servers := []ICEServer{}
+
+	if len(s.config.STUNURLs) > 0 {
+		servers = append(servers, ICEServer{URLs: s.config.STUNURLs})
+	}
+
+	if len(s.config.TURNURLs) > 0 && s.config.Secret != "" {
+		expiry := s.now().Add(s.config.TTL).Unix()
+		username := strconv.FormatInt(expiry, 10) + ":" + strconv.FormatInt(userID, 10)
+
+		servers = append(servers, ICEServer{
+			URLs:       s.config.TURNURLs,
+			Username:   username,
+			Credential: turnCredential(s.config.Secret, username),
+		})
+	}
+
+	return servers
+}
+
+func turnCredential(secret string, username string) string {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,29 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestICEServers(t *testing.T) {
+	s := NewICEServers(ICEConfig{
+		STUNURLs: []string{"stun:turn.example.com:3478"},
+		TURNURLs: []string{"turn:turn.example.com:3478?transport=udp"},
+		Secret:   "north",
+		TTL:      time.Hour,
+	})
+	s.now = func() time.Time {
+		return time.Unix(1700000000, 0)
+	}
+
+	servers := s.For(42)
+	require.Len(t, servers, 2)
+	require.Empty(t, servers[0].Username)
+	require.Equal(t, "1700003600:42", servers[1].Username)
+	// echo -n "1700003600:42" | openssl dgst -sha1 -hmac north -binary | base64
+	require.Equal(t, "WO3ZFttCQxBYtA2Ohz7jjGcQStA=", servers[1].Credential)
+
+	require.Empty(t, NewICEServers(ICEConfig{TURNURLs: []string{"turn:turn.example.com"}}).For(42))
+}
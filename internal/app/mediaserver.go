@@ -0,0 +1,135 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	client "signal/internal/restclient"
+	internalrooms "signal/internal/rooms"
+)
+
+// MediaServer negotiates the WebRTC sessions of the published and played
+// streams.
+type MediaServer interface {
+	// Publish sends the publisher's SDP offer and returns the answer.
+	Publish(ctx context.Context, req StreamRequest) (*ResponseStream, error)
+	// Play sends the viewer's SDP offer for the stream of req.UserID and
+	// returns the answer.
+	Play(ctx context.Context, req StreamRequest) (*ResponseStream, error)
+	// Unpublish stops the publisher session returned by Publish.
+	Unpublish(ctx context.Context, sessionID string) error
+}
+
+// StreamRequest identifies the stream of UserID in Room.
+type StreamRequest struct {
+	Room   string
+	UserID int64
+	// Stream is the kind of stream, camera if empty.
+	Stream string
+	SDP    string
+}
+
+// streamName names the stream on the media server. The camera keeps the
+// bare user id so older clients still find it.
+func (req StreamRequest) streamName() string {
+	name := strconv.FormatInt(req.UserID, 10)
+	if req.Stream != "" && req.Stream != internalrooms.CameraStream {
+		name += "_" + req.Stream
+	}
+
+	return name
+}
+
+// mediaServerError is an answer of a media server that is not a success.
+type mediaServerError struct {
+	status  int
+	message string
+}
+
+func (e *mediaServerError) Error() string {
+	return e.message
+}
+
+// clientError reports whether the request was at fault, a malformed offer
+// for one, rather than the media server.
+func (e *mediaServerError) clientError() bool {
+	return e.status >= 400 && e.status < 500
+}
+
+func newStatusError(status int, body []byte) error {
+	return &mediaServerError{status: status, message: fmt.Sprintf("unexpected status %d: %s", status, body)}
+}
+
+// SRSMediaServer talks to the SRS WebRTC HTTP API.
+type SRSMediaServer struct {
+	host string
+}
+
+func NewSRSMediaServer(host string) *SRSMediaServer {
+	return &SRSMediaServer{host: host}
+}
+
+func (s *SRSMediaServer) Publish(ctx context.Context, req StreamRequest) (*ResponseStream, error) {
+	return s.post(ctx, "/rtc/v1/publish/", req)
+}
+
+func (s *SRSMediaServer) Play(ctx context.Context, req StreamRequest) (*ResponseStream, error) {
+	return s.post(ctx, "/rtc/v1/play/", req)
+}
+
+// Unpublish kicks the publisher off SRS through its HTTP API.
+func (s *SRSMediaServer) Unpublish(ctx context.Context, sessionID string) error {
+	resp, err := client.New().Delete(ctx, "https://"+s.host+"/api/v1/clients/"+url.PathEscape(sessionID), nil)
+	if err != nil {
+		return err
+	}
+
+	// The session is already gone if SRS does not know it.
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, resp.Body)
+	}
+
+	return nil
+}
+
+func (s *SRSMediaServer) post(ctx context.Context, path string, req StreamRequest) (*ResponseStream, error) {
+	data := Stream{
+		StreamURL: getWebrtcURL(s.host, req.Room, req.streamName()),
+		Sdp:       req.SDP,
+	}
+
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request data: %w", err)
+	}
+
+	resp, err := client.New().PostRaw(ctx, "https://"+s.host+path, "application/json", body, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, newStatusError(resp.StatusCode, resp.Body)
+	}
+
+	var response ResponseStream
+	err = json.Unmarshal(resp.Body, &response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response data: %w", err)
+	}
+
+	// SRS answers its failures, a busy stream for one, with 200 and a code.
+	if response.Code != 0 {
+		return nil, &mediaServerError{status: resp.StatusCode, message: fmt.Sprintf("unexpected code %d", response.Code)}
+	}
+
+	return &response, nil
+}
+
+func getWebrtcURL(host string, roomName string, streamName string) string {
+	return "webrtc://" + host + "/" + roomName + "/" + streamName
+}
@@ -0,0 +1,85 @@
+package app
+
+import (
+	"context"
+	"strconv"
+	"sync"
+)
+
+// FakeSession is a stream negotiated with the FakeMediaServer.
+type FakeSession struct {
+	StreamRequest
+	Kind      string
+	SessionID string
+}
+
+// FakeMediaServer answers every offer in memory, it is meant for tests and
+// local development without a media server.
+type FakeMediaServer struct {
+	mu       sync.Mutex
+	sessions []FakeSession
+	err      error
+}
+
+func NewFakeMediaServer() *FakeMediaServer {
+	return &FakeMediaServer{}
+}
+
+func (s *FakeMediaServer) Publish(_ context.Context, req StreamRequest) (*ResponseStream, error) {
+	return s.answer("publish", req)
+}
+
+func (s *FakeMediaServer) Play(_ context.Context, req StreamRequest) (*ResponseStream, error) {
+	return s.answer("play", req)
+}
+
+func (s *FakeMediaServer) Unpublish(_ context.Context, sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+
+	s.sessions = append(s.sessions, FakeSession{Kind: "unpublish", SessionID: sessionID})
+
+	return nil
+}
+
+// Fail makes the following requests return err, nil restores the answers.
+func (s *FakeMediaServer) Fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.err = err
+}
+
+// Sessions returns the negotiated streams, oldest first.
+func (s *FakeMediaServer) Sessions() []FakeSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]FakeSession(nil), s.sessions...)
+}
+
+func (s *FakeMediaServer) answer(kind string, req StreamRequest) (*ResponseStream, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	session := FakeSession{
+		StreamRequest: req,
+		Kind:          kind,
+		SessionID:     "fake-" + strconv.Itoa(len(s.sessions)+1),
+	}
+	s.sessions = append(s.sessions, session)
+
+	return &ResponseStream{
+		SDP:       "answer:" + req.SDP,
+		Server:    "fake",
+		SessionID: session.SessionID,
+	}, nil
+}
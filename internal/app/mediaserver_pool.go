@@ -0,0 +1,339 @@
+package app
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ossrs/go-oryx-lib/logger"
+	internalrooms "signal/internal/rooms"
+)
+
+// MediaServerNode is a media server of the pool.
+type MediaServerNode struct {
+	// Name identifies the node, it is reported in ResponseStream.Server.
+	Name   string
+	Server MediaServer
+	// Weight is the share of the new rooms sent to the node.
+	Weight int
+	// HealthURL is probed with GET, the node is down until it answers 2xx.
+	// Nodes without it are always considered up.
+	HealthURL string
+}
+
+type poolNode struct {
+	MediaServerNode
+	healthy bool
+}
+
+// MediaServerPool spreads the rooms over the media servers. A room sticks
+// to one node, and moves to another node when publishing to its node fails.
+// The streams are played from the node they were published to.
+type MediaServerPool struct {
+	client *http.Client
+
+	mu    sync.RWMutex
+	nodes []*poolNode
+}
+
+func NewMediaServerPool(nodes ...MediaServerNode) (*MediaServerPool, error) {
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("media server pool is empty")
+	}
+
+	p := &MediaServerPool{client: &http.Client{Timeout: 5 * time.Second}}
+
+	names := map[string]bool{}
+	for _, node := range nodes {
+		if node.Name == "" || names[node.Name] {
+			return nil, fmt.Errorf("media server name %q is empty or duplicated", node.Name)
+		}
+		names[node.Name] = true
+
+		if node.Weight <= 0 {
+			node.Weight = 1
+		}
+
+		p.nodes = append(p.nodes, &poolNode{MediaServerNode: node, healthy: true})
+	}
+
+	return p, nil
+}
+
+func newSingleMediaServerPool(name string, server MediaServer) *MediaServerPool {
+	return &MediaServerPool{
+		client: &http.Client{Timeout: 5 * time.Second},
+		nodes: []*poolNode{{
+			MediaServerNode: MediaServerNode{Name: name, Server: server, Weight: 1},
+			healthy:         true,
+		}},
+	}
+}
+
+// Run probes the health of the nodes every interval until ctx is done.
+func (p *MediaServerPool) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		p.probe(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Publish sends the offer to the node of the room, the room fails over to
+// the other healthy nodes until one of them answers.
+func (p *MediaServerPool) Publish(
+	ctx context.Context,
+	r *internalrooms.Room,
+	req StreamRequest,
+) (*ResponseStream, error) {
+	tried := map[string]bool{}
+	var lastErr error
+
+	for {
+		node, err := p.assign(ctx, r, tried)
+		if err != nil {
+			if lastErr != nil {
+				return nil, lastErr
+			}
+			return nil, err
+		}
+
+		response, err := node.Server.Publish(ctx, req)
+		if err == nil {
+			response.Server = node.Name
+			return response, nil
+		}
+
+		logger.Wf(ctx, "Publish %v to media server %v err %v", req.UserID, node.Name, err)
+
+		// Another node would refuse the offer, or the client, all the same.
+		if !failover(ctx, err) {
+			return nil, err
+		}
+
+		lastErr = err
+		tried[node.Name] = true
+		p.markDown(ctx, node.Name)
+	}
+}
+
+// Play sends the offer to the node the stream is published to, the node of
+// the room if it is not known.
+func (p *MediaServerPool) Play(
+	ctx context.Context,
+	r *internalrooms.Room,
+	req StreamRequest,
+) (*ResponseStream, error) {
+	name := r.StreamMediaServer(req.UserID, req.Stream)
+	if name == "" {
+		name = r.AssignedMediaServer()
+	}
+
+	node, ok := p.node(name)
+	if !ok {
+		var err error
+		if node, err = p.assign(ctx, r, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	response, err := node.Server.Play(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	response.Server = node.Name
+
+	return response, nil
+}
+
+// Unpublish stops the publisher session on the node it was negotiated
+// with, whatever its health.
+func (p *MediaServerPool) Unpublish(ctx context.Context, mediaServer string, sessionID string) error {
+	node, ok := p.node(mediaServer)
+	if !ok {
+		return fmt.Errorf("unknown media server %q", mediaServer)
+	}
+
+	return node.Server.Unpublish(ctx, sessionID)
+}
+
+// failover reports whether the publish error is the node's fault, only
+// unreachable nodes and server errors are worth trying another node.
+func failover(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var e *mediaServerError
+	if stderrors.As(err, &e) {
+		return !e.clientError()
+	}
+
+	return true
+}
+
+// Healthy returns the health of every node by name.
+func (p *MediaServerPool) Healthy() map[string]bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	healthy := make(map[string]bool, len(p.nodes))
+	for _, node := range p.nodes {
+		healthy[node.Name] = node.healthy
+	}
+
+	return healthy
+}
+
+// assign returns the node of the room, the room is moved to another node
+// if its node is down or was already tried.
+func (p *MediaServerPool) assign(
+	ctx context.Context,
+	r *internalrooms.Room,
+	tried map[string]bool,
+) (MediaServerNode, error) {
+	for {
+		current := r.AssignedMediaServer()
+		if node, ok := p.node(current); ok && !tried[current] && p.isHealthy(current) {
+			return node, nil
+		}
+
+		node, ok := p.pick(tried)
+		if !ok {
+			return MediaServerNode{}, fmt.Errorf("no healthy media server for room %v", r.Name)
+		}
+
+		if r.AssignMediaServer(ctx, current, node.Name) == node.Name {
+			logger.Tf(ctx, "Room %v assigned to media server %v", r.Name, node.Name)
+			return node, nil
+		}
+		// Another stream of the room assigned it concurrently, check its choice.
+	}
+}
+
+// pick chooses a healthy node by weight.
+func (p *MediaServerPool) pick(exclude map[string]bool) (MediaServerNode, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	total := 0
+	for _, node := range p.nodes {
+		if node.healthy && !exclude[node.Name] {
+			total += node.Weight
+		}
+	}
+
+	if total == 0 {
+		return MediaServerNode{}, false
+	}
+
+	n := rand.IntN(total)
+	for _, node := range p.nodes {
+		if !node.healthy || exclude[node.Name] {
+			continue
+		}
+		if n < node.Weight {
+			return node.MediaServerNode, true
+		}
+		n -= node.Weight
+	}
+
+	return MediaServerNode{}, false
+}
+
+func (p *MediaServerPool) node(name string) (MediaServerNode, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, node := range p.nodes {
+		if node.Name == name {
+			return node.MediaServerNode, true
+		}
+	}
+
+	return MediaServerNode{}, false
+}
+
+func (p *MediaServerPool) isHealthy(name string) bool {
+	return p.Healthy()[name]
+}
+
+// markDown takes a failing node out of the rotation until its health probe
+// passes again. Nodes without a probe are never taken out.
+func (p *MediaServerPool) markDown(ctx context.Context, name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, node := range p.nodes {
+		if node.Name == name && node.HealthURL != "" && node.healthy {
+			node.healthy = false
+			logger.Wf(ctx, "Media server %v is down", name)
+		}
+	}
+}
+
+func (p *MediaServerPool) probe(ctx context.Context) {
+	p.mu.RLock()
+	nodes := make([]MediaServerNode, 0, len(p.nodes))
+	for _, node := range p.nodes {
+		nodes = append(nodes, node.MediaServerNode)
+	}
+	p.mu.RUnlock()
+
+	for _, node := range nodes {
+		if node.HealthURL == "" {
+			continue
+		}
+
+		err := p.check(ctx, node.HealthURL)
+		p.setHealthy(ctx, node.Name, err)
+	}
+}
+
+func (p *MediaServerPool) check(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send HTTP request: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (p *MediaServerPool) setHealthy(ctx context.Context, name string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, node := range p.nodes {
+		if node.Name != name || node.healthy == (err == nil) {
+			continue
+		}
+
+		node.healthy = err == nil
+		if err != nil {
+			logger.Wf(ctx, "Media server %v is down, err %v", name, err)
+		} else {
+			logger.Tf(ctx, "Media server %v is up", name)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"signal/internal/metrics"
+	internalrooms "signal/internal/rooms"
+)
+
+func TestMediaServerPoolFailover(t *testing.T) {
+	ctx := context.Background()
+
+	var up atomic.Bool
+	health := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if !up.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer health.Close()
+	up.Store(true)
+
+	first, second := NewFakeMediaServer(), NewFakeMediaServer()
+	pool, err := NewMediaServerPool(
+		MediaServerNode{Name: "first", Server: first, Weight: 1, HealthURL: health.URL},
+		MediaServerNode{Name: "second", Server: second, Weight: 1},
+	)
+	require.NoError(t, err)
+
+	r := &internalrooms.Room{Name: "call"}
+	require.Equal(t, "first", r.AssignMediaServer(ctx, "", "first"))
+
+	response, err := pool.Publish(ctx, r, StreamRequest{Room: "call", UserID: 1})
+	require.NoError(t, err)
+	require.Equal(t, "first", response.Server)
+
+	first.Fail(errors.New("down"))
+	up.Store(false)
+
+	response, err = pool.Publish(ctx, r, StreamRequest{Room: "call", UserID: 2})
+	require.NoError(t, err)
+	require.Equal(t, "second", response.Server)
+	require.Equal(t, "second", r.AssignedMediaServer())
+	require.False(t, pool.Healthy()["first"])
+
+	response, err = pool.Play(ctx, r, StreamRequest{Room: "call", UserID: 2})
+	require.NoError(t, err)
+	require.Equal(t, "second", response.Server)
+	require.Len(t, second.Sessions(), 2)
+
+	up.Store(true)
+	probeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go pool.Run(probeCtx, time.Millisecond)
+
+	require.Eventually(t, func() bool {
+		return pool.Healthy()["first"]
+	}, time.Second, time.Millisecond)
+}
+
+func TestMediaServerPoolUnavailable(t *testing.T) {
+	failing := NewFakeMediaServer()
+	failing.Fail(errors.New("down"))
+
+	pool, err := NewMediaServerPool(MediaServerNode{Name: "only", Server: failing})
+	require.NoError(t, err)
+
+	_, err = pool.Publish(context.Background(), &internalrooms.Room{Name: "call"}, StreamRequest{Room: "call", UserID: 1})
+	require.EqualError(t, err, "down")
+
+	_, err = NewMediaServerPool(MediaServerNode{Name: "only"}, MediaServerNode{Name: "only"})
+	require.Error(t, err)
+}
+
+func TestMediaServerPoolClientError(t *testing.T) {
+	ctx := context.Background()
+
+	first, second := NewFakeMediaServer(), NewFakeMediaServer()
+	pool, err := NewMediaServerPool(
+		MediaServerNode{Name: "first", Server: first, HealthURL: "http://127.0.0.1:1"},
+		MediaServerNode{Name: "second", Server: second},
+	)
+	require.NoError(t, err)
+
+	r := &internalrooms.Room{Name: "call"}
+	require.Equal(t, "first", r.AssignMediaServer(ctx, "", "first"))
+
+	// A malformed offer is refused by every node, the room stays put.
+	first.Fail(newStatusError(http.StatusBadRequest, []byte("bad sdp")))
+	_, err = pool.Publish(ctx, r, StreamRequest{Room: "call", UserID: 1})
+	require.Error(t, err)
+	require.Equal(t, "first", r.AssignedMediaServer())
+	require.True(t, pool.Healthy()["first"])
+	require.Empty(t, second.Sessions())
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	first.Fail(errors.New("canceled"))
+	_, err = pool.Publish(cancelled, r, StreamRequest{Room: "call", UserID: 1})
+	require.Error(t, err)
+	require.True(t, pool.Healthy()["first"])
+}
+
+func TestMediaServerPoolPlayPublishedNode(t *testing.T) {
+	ctx := context.Background()
+
+	first, second := NewFakeMediaServer(), NewFakeMediaServer()
+	pool, err := NewMediaServerPool(
+		MediaServerNode{Name: "first", Server: first},
+		MediaServerNode{Name: "second", Server: second},
+	)
+	require.NoError(t, err)
+
+	r := &internalrooms.Room{Name: "call", Type: internalrooms.GroupType}
+	alice := &internalrooms.Participant{Room: r, Out: internalrooms.NewQueue(internalrooms.QueueConfig{}, nil), UserID: 1}
+	require.NoError(t, r.Add(alice))
+	require.Equal(t, "first", r.AssignMediaServer(ctx, "", "first"))
+
+	r.SetSession(alice, internalrooms.CameraStream, internalrooms.StreamSession{MediaServer: "first", ID: "fake-1"})
+	_, err = r.Publish(alice, internalrooms.CameraStream)
+	require.NoError(t, err)
+
+	// The room moved after alice published, her stream is still on first.
+	require.Equal(t, "second", r.AssignMediaServer(ctx, "first", "second"))
+
+	response, err := pool.Play(ctx, r, StreamRequest{Room: "call", UserID: 1, Stream: internalrooms.CameraStream})
+	require.NoError(t, err)
+	require.Equal(t, "first", response.Server)
+}
+
+func TestStreamSessionsUnpublish(t *testing.T) {
+	fake := NewFakeMediaServer()
+	a := &App{mediaServers: newSingleMediaServerPool("fake", fake), metrics: metrics.New()}
+
+	streamSessions{a}.Observe(context.Background(), internalrooms.Event{
+		Room:    "call",
+		Kind:    internalrooms.NotifyKind,
+		Event:   internalrooms.StreamEndedEvent,
+		Session: &internalrooms.StreamSession{MediaServer: "fake", ID: "fake-1"},
+	})
+
+	require.Eventually(t, func() bool {
+		sessions := fake.Sessions()
+		return len(sessions) == 1 && sessions[0].Kind == "unpublish" && sessions[0].SessionID == "fake-1"
+	}, time.Second, 10*time.Millisecond)
+
+	require.Error(t, a.mediaServers.Unpublish(context.Background(), "other", "fake-1"))
+}
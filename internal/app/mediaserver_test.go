@@ -0,0 +1,98 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWHIPMediaServer(t *testing.T) {
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+
+		switch r.URL.Path {
+		case "/sessions/1":
+			require.Equal(t, http.MethodDelete, r.Method)
+			deleted = append(deleted, r.URL.Path)
+		case "/whip/my call/1":
+			require.Equal(t, "application/sdp", r.Header.Get("Content-Type"))
+			w.Header().Set("Location", "/sessions/1")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte("answer:" + string(body)))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	mediaServer, err := NewWHIPMediaServer(WHIPConfig{
+		PublishURL: server.URL + "/whip/{room}/{userId}",
+		PlayURL:    server.URL + "/whep/{room}/{userId}",
+		Token:      "secret",
+	})
+	require.NoError(t, err)
+
+	response, err := mediaServer.Publish(context.Background(), StreamRequest{Room: "my call", UserID: 1, SDP: "offer"})
+	require.NoError(t, err)
+	require.Equal(t, "answer:offer", response.SDP)
+	require.Equal(t, server.URL+"/sessions/1", response.SessionID)
+
+	_, err = mediaServer.Play(context.Background(), StreamRequest{Room: "my call", UserID: 1, SDP: "offer"})
+	require.Error(t, err)
+
+	require.NoError(t, mediaServer.Unpublish(context.Background(), response.SessionID))
+	require.Equal(t, []string{"/sessions/1"}, deleted)
+}
+
+func TestFakeMediaServer(t *testing.T) {
+	mediaServer := NewFakeMediaServer()
+
+	response, err := mediaServer.Play(context.Background(), StreamRequest{Room: "call", UserID: 2, SDP: "offer"})
+	require.NoError(t, err)
+	require.Equal(t, "answer:offer", response.SDP)
+
+	mediaServer.Fail(errors.New("down"))
+	_, err = mediaServer.Publish(context.Background(), StreamRequest{Room: "call", UserID: 1})
+	require.Error(t, err)
+
+	sessions := mediaServer.Sessions()
+	require.Len(t, sessions, 1)
+	require.Equal(t, "play", sessions[0].Kind)
+	require.Equal(t, int64(2), sessions[0].UserID)
+}
+
+func TestExpandStreamURL(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		req      StreamRequest
+		expected string
+	}{
+		{
+			name:     "Default stream",
+			req:      StreamRequest{Room: "my call", UserID: 1},
+			expected: "https://sfu/whip/my%20call/1/1",
+		},
+		{
+			name:     "Camera stream",
+			req:      StreamRequest{Room: "call", UserID: 1, Stream: "camera"},
+			expected: "https://sfu/whip/call/1/1",
+		},
+		{
+			name:     "Screen stream",
+			req:      StreamRequest{Room: "call", UserID: 1, Stream: "screen"},
+			expected: "https://sfu/whip/call/1/1_screen",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, expandStreamURL("https://sfu/whip/{room}/{userId}/{stream}", tc.req))
+		})
+	}
+}
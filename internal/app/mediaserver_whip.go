@@ -0,0 +1,107 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	client "signal/internal/restclient"
+)
+
+// WHIPConfig describes an SFU speaking WHIP for publishing and WHEP for
+// playing. The URLs may contain the {room}, {userId} and {stream}
+// placeholders, {stream} is the media server name of the stream: the user
+// id for the camera, suffixed with the kind for the other streams.
+type WHIPConfig struct {
+	PublishURL string
+	PlayURL    string
+	Token      string
+}
+
+// WHIPMediaServer posts the SDP offers to a WHIP/WHEP endpoint, the answer
+// comes back as the response body and the session as its Location.
+type WHIPMediaServer struct {
+	config WHIPConfig
+}
+
+func NewWHIPMediaServer(config WHIPConfig) (*WHIPMediaServer, error) {
+	if config.PublishURL == "" || config.PlayURL == "" {
+		return nil, fmt.Errorf("whip media server needs both publish and play URLs")
+	}
+
+	return &WHIPMediaServer{config: config}, nil
+}
+
+func (s *WHIPMediaServer) Publish(ctx context.Context, req StreamRequest) (*ResponseStream, error) {
+	return s.post(ctx, s.config.PublishURL, req)
+}
+
+func (s *WHIPMediaServer) Play(ctx context.Context, req StreamRequest) (*ResponseStream, error) {
+	return s.post(ctx, s.config.PlayURL, req)
+}
+
+// Unpublish deletes the WHIP session, its id is the session URL.
+func (s *WHIPMediaServer) Unpublish(ctx context.Context, sessionID string) error {
+	header := http.Header{}
+	if s.config.Token != "" {
+		header.Set("Authorization", "Bearer "+s.config.Token)
+	}
+
+	resp, err := client.New().Delete(ctx, sessionID, header)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, resp.Body)
+	}
+
+	return nil
+}
+
+func (s *WHIPMediaServer) post(ctx context.Context, template string, req StreamRequest) (*ResponseStream, error) {
+	endpoint, err := url.Parse(expandStreamURL(template, req))
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint: %w", err)
+	}
+
+	header := http.Header{}
+	if s.config.Token != "" {
+		header.Set("Authorization", "Bearer "+s.config.Token)
+	}
+
+	resp, err := client.New().PostRaw(ctx, endpoint.String(), "application/sdp", []byte(req.SDP), header)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return nil, newStatusError(resp.StatusCode, resp.Body)
+	}
+
+	response := ResponseStream{
+		SDP:    string(resp.Body),
+		Server: endpoint.Host,
+	}
+
+	if location := resp.Header.Get("Location"); location != "" {
+		session, err := endpoint.Parse(location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid session location %q: %w", location, err)
+		}
+		response.SessionID = session.String()
+	}
+
+	return &response, nil
+}
+
+func expandStreamURL(template string, req StreamRequest) string {
+	return strings.NewReplacer(
+		"{room}", url.PathEscape(req.Room),
+		"{userId}", strconv.FormatInt(req.UserID, 10),
+		"{stream}", url.PathEscape(req.streamName()),
+	).Replace(template)
+}
@@ -1,6 +1,10 @@
 package app
 
-import "signal/internal/rooms"
+import (
+	"encoding/json"
+
+	"signal/internal/rooms"
+)
 
 type Action struct {
 	TID     string `json:"tid"`
@@ -15,6 +19,7 @@ type EventPreconnect struct {
 		Token    string `json:"token"`
 		UserID   int64  `json:"userId"`
 		DeviceID string `json:"deviceId"`
+		Type     string `json:"type"`
 	} `json:"msg"`
 }
 
@@ -34,6 +39,11 @@ type EventJoin struct {
 		CameraType   *string `json:"cameraType"`
 		BatteryLife  float64 `json:"batteryLife"`
 		IsReady      bool    `json:"isReady"`
+		Mode         string  `json:"mode"`
+		Type         string  `json:"type"`
+		Role         string  `json:"role"`
+		// InvitedParticipants are invited and rung when joining.
+		InvitedParticipants []*rooms.InvitedParticipant `json:"invitedParticipants"`
 	} `json:"msg"`
 }
 
@@ -41,6 +51,8 @@ type EventPublish struct {
 	Message struct {
 		Room   string `json:"room"`
 		UserID int64  `json:"userId"`
+		// Stream is the kind of stream published, camera if empty.
+		Stream string `json:"stream"`
 	} `json:"msg"`
 }
 
@@ -49,6 +61,7 @@ type EventStreamPublish struct {
 		Room   string `json:"room"`
 		UserID int64  `json:"userId"`
 		SDP    string `json:"sdp"`
+		Stream string `json:"stream"`
 	} `json:"msg"`
 }
 
@@ -58,6 +71,7 @@ type EventStreamPlay struct {
 		UserID        int64  `json:"userId"`
 		SDP           string `json:"sdp"`
 		ParticipantID int64  `json:"participantId"`
+		Stream        string `json:"stream"`
 	} `json:"msg"`
 }
 
@@ -95,9 +109,134 @@ type EventInviteUsers struct {
 	} `json:"msg"`
 }
 
+type EventRegisterPushToken struct {
+	Message struct {
+		Room      string `json:"room"`
+		Token     string `json:"token"`
+		UserID    int64  `json:"userId"`
+		DeviceID  string `json:"deviceId"`
+		Platform  string `json:"platform"`
+		PushToken string `json:"pushToken"`
+		VoIP      bool   `json:"voip"`
+	} `json:"msg"`
+}
+
+type EventCancelInvite struct {
+	Message struct {
+		Room         string `json:"room"`
+		UserID       int64  `json:"userId"`
+		TargetUserID int64  `json:"targetUserId"`
+	} `json:"msg"`
+}
+
+type EventUnpublish struct {
+	Message struct {
+		Room   string `json:"room"`
+		UserID int64  `json:"userId"`
+		Stream string `json:"stream"`
+	} `json:"msg"`
+}
+
+type EventLeave struct {
+	Message struct {
+		Room   string `json:"room"`
+		UserID int64  `json:"userId"`
+	} `json:"msg"`
+}
+
+type EventHangup struct {
+	Message struct {
+		Room   string `json:"room"`
+		UserID int64  `json:"userId"`
+	} `json:"msg"`
+}
+
+type EventResume struct {
+	Message struct {
+		Room        string `json:"room"`
+		UserID      int64  `json:"userId"`
+		ResumeToken string `json:"resumeToken"`
+	} `json:"msg"`
+}
+
+type EventRelay struct {
+	Message struct {
+		Room         string          `json:"room"`
+		UserID       int64           `json:"userId"`
+		TargetUserID int64           `json:"targetUserId"`
+		SDP          string          `json:"sdp"`
+		Candidate    json.RawMessage `json:"candidate"`
+	} `json:"msg"`
+}
+
+type EventModerate struct {
+	Message struct {
+		Room         string `json:"room"`
+		UserID       int64  `json:"userId"`
+		TargetUserID int64  `json:"targetUserId"`
+	} `json:"msg"`
+}
+
+type EventChat struct {
+	Message struct {
+		Room         string `json:"room"`
+		UserID       int64  `json:"userId"`
+		TargetUserID int64  `json:"targetUserId"`
+		Text         string `json:"text"`
+	} `json:"msg"`
+}
+
+type EventChatAck struct {
+	Message struct {
+		Room      string `json:"room"`
+		UserID    int64  `json:"userId"`
+		MessageID string `json:"messageId"`
+		Status    string `json:"status"`
+	} `json:"msg"`
+}
+
+type EventCustom struct {
+	Message struct {
+		Room          string          `json:"room"`
+		UserID        int64           `json:"userId"`
+		TargetUserIDs []int64         `json:"targetUserIds"`
+		Type          string          `json:"type"`
+		Payload       json.RawMessage `json:"payload"`
+	} `json:"msg"`
+}
+
+type EventHand struct {
+	Message struct {
+		Room   string `json:"room"`
+		UserID int64  `json:"userId"`
+		// TargetUserID lets a moderator lower the hand of another
+		// participant.
+		TargetUserID int64 `json:"targetUserId"`
+	} `json:"msg"`
+}
+
+type EventReaction struct {
+	Message struct {
+		Room     string `json:"room"`
+		UserID   int64  `json:"userId"`
+		Reaction string `json:"reaction"`
+	} `json:"msg"`
+}
+
+type EventICEServers struct {
+	Message struct {
+		Room   string `json:"room"`
+		UserID int64  `json:"userId"`
+	} `json:"msg"`
+}
+
 type ResponsePreconnect struct {
 	Action string        `json:"action"`
 	Device *rooms.Device `json:"device"`
+	// CallState tells a device whether the user already answered the call
+	// on another one, CallStates gives the state of every user.
+	CallState  rooms.CallState   `json:"callState"`
+	CallStates []rooms.CallState `json:"callStates"`
 }
 
 type ResponseJoin struct {
@@ -106,6 +245,38 @@ type ResponseJoin struct {
 	Participants        []*rooms.Participant        `json:"participants"`
 	InvitedParticipants []*rooms.InvitedParticipant `json:"invitedParticipants"`
 	StartedAt           *int64                      `json:"startedAt"`
+	ResumeToken         string                      `json:"resumeToken"`
+	Mode                string                      `json:"mode"`
+	Type                string                      `json:"type"`
+	IceServers          []ICEServer                 `json:"iceServers"`
+	ActiveSpeaker       int64                       `json:"activeSpeaker"`
+	ChatHistory         []*rooms.ChatMessage        `json:"chatHistory"`
+	Hands               []rooms.RaisedHand          `json:"hands"`
+}
+
+type ResponseResume struct {
+	Action              string                      `json:"action"`
+	Self                *rooms.Participant          `json:"self"`
+	Participants        []*rooms.Participant        `json:"participants"`
+	InvitedParticipants []*rooms.InvitedParticipant `json:"invitedParticipants"`
+	StartedAt           *int64                      `json:"startedAt"`
+	Hands               []rooms.RaisedHand          `json:"hands"`
+	Missed              []json.RawMessage           `json:"missed"`
+}
+
+type ResponseRegisterPushToken struct {
+	Action string `json:"action"`
+}
+
+type ResponseChat struct {
+	Action  string             `json:"action"`
+	Message *rooms.ChatMessage `json:"message"`
+}
+
+type ResponseICEServers struct {
+	Action     string      `json:"action"`
+	IceServers []ICEServer `json:"iceServers"`
+	TTL        int64       `json:"ttl"`
 }
 
 type ResponseStream struct {
@@ -117,6 +288,21 @@ type ResponseStream struct {
 	SessionID string `json:"sessionid"`
 }
 
+type ResponseError struct {
+	Action  string    `json:"action"`
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+type AdminRoomSummary struct {
+	Name                string `json:"name"`
+	Type                string `json:"type"`
+	Participants        int    `json:"participants"`
+	InvitedParticipants int    `json:"invitedParticipants"`
+	Devices             int    `json:"devices"`
+	StartedAt           *int64 `json:"startedAt"`
+}
+
 type Tid struct {
 	TID     string      `json:"tid"`
 	Message interface{} `json:"msg"`
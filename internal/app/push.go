@@ -0,0 +1,282 @@
+package app
+
+import (
+	"context"
+	stderrors "errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ossrs/go-oryx-lib/logger"
+	internalrooms "signal/internal/rooms"
+)
+
+const (
+	FCMPlatform  string = "fcm"
+	APNsPlatform string = "apns"
+
+	// IncomingCallPush rings a device that has no connection to the room.
+	IncomingCallPush string = "incomingCall"
+	// CancelCallPush stops the ringing started by an IncomingCallPush.
+	CancelCallPush string = "cancelCall"
+
+	AnsweredPushReason  string = "answered"
+	DeclinedPushReason  string = "declined"
+	CancelledPushReason string = "cancelled"
+	ExpiredPushReason   string = "expired"
+	EndedPushReason     string = "ended"
+)
+
+// pushTTL is how long the providers keep trying to deliver a push. A call
+// nobody picked up in time is not worth ringing.
+const pushTTL = time.Minute
+
+// pushExpiry returns when a push sent at now is dropped by the providers.
+func pushExpiry(now time.Time) time.Time {
+	return now.Add(pushTTL)
+}
+
+// ErrPushTokenInvalid is returned by the providers for tokens they do not
+// know anymore, such tokens are unregistered.
+var ErrPushTokenInvalid = stderrors.New("push token is not registered")
+
+// PushToken is a device registered for call pushes.
+type PushToken struct {
+	UserID   int64  `json:"userId"`
+	DeviceID string `json:"deviceId"`
+	Platform string `json:"platform"`
+	Token    string `json:"token"`
+	// VoIP tokens are woken by VoIP pushes, PushKit ones on iOS.
+	VoIP bool `json:"voip"`
+}
+
+// PushNotification is the payload of a call push, every provider maps it
+// to its own format.
+type PushNotification struct {
+	Type        string `json:"type"`
+	Room        string `json:"room"`
+	RoomType    string `json:"roomType,omitempty"`
+	CallerID    int64  `json:"callerId,omitempty"`
+	CallerName  string `json:"callerName,omitempty"`
+	CallerPhoto string `json:"callerPhoto,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+	Timestamp   int64  `json:"timestamp"`
+}
+
+// PushProvider delivers pushes to the devices of one platform.
+type PushProvider interface {
+	Send(ctx context.Context, token PushToken, n PushNotification) error
+}
+
+// PushTokenStore keeps the push tokens of the users.
+type PushTokenStore interface {
+	Register(ctx context.Context, token PushToken) error
+	Unregister(ctx context.Context, token PushToken) error
+	Tokens(ctx context.Context, userID int64) ([]PushToken, error)
+}
+
+// MemoryPushTokenStore keeps the tokens of a single instance.
+type MemoryPushTokenStore struct {
+	mu     sync.Mutex
+	tokens map[int64][]PushToken
+}
+
+func NewMemoryPushTokenStore() *MemoryPushTokenStore {
+	return &MemoryPushTokenStore{tokens: make(map[int64][]PushToken)}
+}
+
+// Register adds the token, it replaces the token of the same device.
+func (s *MemoryPushTokenStore) Register(_ context.Context, token PushToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens := s.tokens[token.UserID]
+	for i, registered := range tokens {
+		if registered.Token == token.Token || token.DeviceID != "" && registered.DeviceID == token.DeviceID {
+			tokens[i] = token
+			return nil
+		}
+	}
+	s.tokens[token.UserID] = append(tokens, token)
+
+	return nil
+}
+
+func (s *MemoryPushTokenStore) Unregister(_ context.Context, token PushToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens := s.tokens[token.UserID]
+	for i, registered := range tokens {
+		if registered.Token == token.Token {
+			s.tokens[token.UserID] = append(tokens[:i], tokens[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryPushTokenStore) Tokens(_ context.Context, userID int64) ([]PushToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]PushToken(nil), s.tokens[userID]...), nil
+}
+
+// Pusher rings invited users on the devices that are not connected to the
+// room and cancels the pushes once the call is answered, declined or over.
+// The cancellations are sent by the instance that rang, it only learns
+// about the events of its own connections.
+type Pusher struct {
+	tokens    PushTokenStore
+	providers map[string]PushProvider
+
+	mu sync.Mutex
+	// ringing holds the users rung by room.
+	ringing map[string]map[int64]struct{}
+}
+
+func NewPusher(tokens PushTokenStore, providers map[string]PushProvider) *Pusher {
+	return &Pusher{
+		tokens:    tokens,
+		providers: providers,
+		ringing:   make(map[string]map[int64]struct{}),
+	}
+}
+
+// Register adds a device token of the user.
+func (p *Pusher) Register(ctx context.Context, token PushToken) error {
+	return p.tokens.Register(ctx, token)
+}
+
+// Ring sends an incoming call push for the room to the devices of the
+// users, except those already connected to the room.
+func (p *Pusher) Ring(ctx context.Context, r *internalrooms.Room, caller *internalrooms.Participant, userIDs []int64) {
+	if len(userIDs) == 0 {
+		return
+	}
+
+	snapshot := r.Snapshot()
+	connected := make(map[string]bool, len(snapshot.Devices))
+	for _, device := range snapshot.Devices {
+		connected[device.ID] = true
+	}
+
+	n := PushNotification{
+		Type:      IncomingCallPush,
+		Room:      snapshot.Name,
+		RoomType:  snapshot.Type,
+		CallerID:  caller.UserID,
+		Timestamp: time.Now().Unix(),
+	}
+	n.CallerName = strings.TrimSpace(caller.FirstName + " " + caller.LastName)
+	if caller.Photo != nil {
+		n.CallerPhoto = *caller.Photo
+	}
+
+	p.mu.Lock()
+	ringing, ok := p.ringing[n.Room]
+	if !ok {
+		ringing = make(map[int64]struct{})
+		p.ringing[n.Room] = ringing
+	}
+	for _, userID := range userIDs {
+		ringing[userID] = struct{}{}
+	}
+	p.mu.Unlock()
+
+	for _, userID := range userIDs {
+		p.push(ctx, userID, n, func(token PushToken) bool {
+			return !connected[token.DeviceID]
+		})
+	}
+}
+
+// Observe cancels the pushes of the users who answered or declined on a
+// device, whose invitation ended, and of everyone rung for a call that is
+// over.
+func (p *Pusher) Observe(ctx context.Context, e internalrooms.Event) {
+	switch {
+	case e.Kind == internalrooms.PreconnectKind && e.Device != nil:
+		switch e.Event {
+		case internalrooms.AcceptStatus:
+			p.cancel(ctx, e.Room, e.Device.UserID, AnsweredPushReason)
+		case internalrooms.DeclineStatus:
+			p.cancel(ctx, e.Room, e.Device.UserID, DeclinedPushReason)
+		}
+	case e.Kind == internalrooms.NotifyKind && e.Event == "join" && e.Peer != nil:
+		p.cancel(ctx, e.Room, e.Peer.UserID, AnsweredPushReason)
+	case e.Kind == internalrooms.InviteKind && e.Event == internalrooms.CancelInviteEvent:
+		p.cancel(ctx, e.Room, e.UserID, CancelledPushReason)
+	case e.Kind == internalrooms.InviteKind && e.Event == internalrooms.InviteExpiredEvent:
+		p.cancel(ctx, e.Room, e.UserID, ExpiredPushReason)
+	case e.Kind == internalrooms.EndKind || e.Kind == internalrooms.EmptyKind:
+		p.mu.Lock()
+		ringing := p.ringing[e.Room]
+		delete(p.ringing, e.Room)
+		p.mu.Unlock()
+
+		for userID := range ringing {
+			p.pushCancel(ctx, userID, e.Room, EndedPushReason)
+		}
+	}
+}
+
+func (p *Pusher) cancel(ctx context.Context, room string, userID int64, reason string) {
+	p.mu.Lock()
+	_, ok := p.ringing[room][userID]
+	delete(p.ringing[room], userID)
+	if len(p.ringing[room]) == 0 {
+		delete(p.ringing, room)
+	}
+	p.mu.Unlock()
+
+	if ok {
+		p.pushCancel(ctx, userID, room, reason)
+	}
+}
+
+func (p *Pusher) pushCancel(ctx context.Context, userID int64, room string, reason string) {
+	p.push(ctx, userID, PushNotification{
+		Type:      CancelCallPush,
+		Room:      room,
+		Reason:    reason,
+		Timestamp: time.Now().Unix(),
+	}, nil)
+}
+
+// push sends n to the tokens of the user accepted by filter. It runs in the
+// background, observers and handlers must not wait for the providers.
+func (p *Pusher) push(ctx context.Context, userID int64, n PushNotification, filter func(PushToken) bool) {
+	// The push outlives the connection that triggered it.
+	ctx = context.WithoutCancel(ctx)
+
+	go func() {
+		tokens, err := p.tokens.Tokens(ctx, userID)
+		if err != nil {
+			logger.Wf(ctx, "Push tokens of %d err %v", userID, err)
+			return
+		}
+
+		for _, token := range tokens {
+			if filter != nil && !filter(token) {
+				continue
+			}
+
+			provider, ok := p.providers[token.Platform]
+			if !ok {
+				continue
+			}
+
+			err := provider.Send(ctx, token, n)
+			if stderrors.Is(err, ErrPushTokenInvalid) {
+				logger.Tf(ctx, "Push token of %d device %s is invalid, unregister", token.UserID, token.DeviceID)
+				err = p.tokens.Unregister(ctx, token)
+			}
+			if err != nil {
+				logger.Wf(ctx, "Push %s of %s to %d err %v", n.Type, n.Room, token.UserID, err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,153 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	client "signal/internal/restclient"
+)
+
+const (
+	apnsEndpoint        = "https://api.push.apple.com"
+	apnsSandboxEndpoint = "https://api.sandbox.push.apple.com"
+
+	// apnsTokenLifetime renews the provider token before Apple rejects it
+	// after an hour.
+	apnsTokenLifetime = 50 * time.Minute
+)
+
+// APNsConfig holds the token based authentication of an app to APNs.
+type APNsConfig struct {
+	// KeyFile is the .p8 signing key.
+	KeyFile string
+	KeyID   string
+	TeamID  string
+	// Topic is the bundle id of the app, VoIP pushes go to Topic.voip.
+	Topic   string
+	Sandbox bool
+	// Endpoint replaces the APNs servers, for tests.
+	Endpoint string
+}
+
+// APNsPushProvider sends pushes over the APNs HTTP/2 API. VoIP tokens get
+// VoIP pushes for CallKit, the others an alert.
+type APNsPushProvider struct {
+	config APNsConfig
+	key    any
+
+	mu       sync.Mutex
+	token    string
+	issuedAt time.Time
+}
+
+func NewAPNsPushProvider(config APNsConfig) (*APNsPushProvider, error) {
+	if config.KeyID == "" || config.TeamID == "" || config.Topic == "" {
+		return nil, fmt.Errorf("apns needs a key id, a team id and a topic")
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = apnsEndpoint
+		if config.Sandbox {
+			config.Endpoint = apnsSandboxEndpoint
+		}
+	}
+
+	data, err := os.ReadFile(config.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("read key: %w", err)
+	}
+
+	key, err := jwt.ParseECPrivateKeyFromPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse key: %w", err)
+	}
+
+	return &APNsPushProvider{config: config, key: key}, nil
+}
+
+func (p *APNsPushProvider) Send(ctx context.Context, token PushToken, n PushNotification) error {
+	providerToken, err := p.providerToken()
+	if err != nil {
+		return err
+	}
+
+	aps := map[string]any{}
+	pushType, topic, priority := "alert", p.config.Topic, "10"
+	switch {
+	case token.VoIP:
+		pushType, topic = "voip", p.config.Topic+".voip"
+	case n.Type == IncomingCallPush:
+		aps["alert"] = map[string]string{"title": n.CallerName, "body": "Incoming call"}
+		aps["sound"] = "default"
+	default:
+		aps["content-available"] = 1
+		pushType, priority = "background", "5"
+	}
+
+	body, err := json.Marshal(struct {
+		APS map[string]any `json:"aps"`
+		PushNotification
+	}{aps, n})
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", "bearer "+providerToken)
+	header.Set("apns-topic", topic)
+	header.Set("apns-push-type", pushType)
+	header.Set("apns-priority", priority)
+	header.Set("apns-collapse-id", n.Room)
+	header.Set("apns-expiration", strconv.FormatInt(pushExpiry(time.Now()).Unix(), 10))
+
+	resp, err := client.New().PostRaw(ctx, p.config.Endpoint+"/3/device/"+token.Token, "application/json", body, header)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	reason := struct {
+		Reason string `json:"reason"`
+	}{}
+	_ = json.Unmarshal(resp.Body, &reason)
+
+	if resp.StatusCode == http.StatusGone || reason.Reason == "BadDeviceToken" {
+		return fmt.Errorf("%w: %s", ErrPushTokenInvalid, reason.Reason)
+	}
+
+	return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, resp.Body)
+}
+
+func (p *APNsPushProvider) providerToken() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.token != "" && time.Since(p.issuedAt) < apnsTokenLifetime {
+		return p.token, nil
+	}
+
+	now := time.Now()
+	jwtToken := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss": p.config.TeamID,
+		"iat": now.Unix(),
+	})
+	jwtToken.Header["kid"] = p.config.KeyID
+
+	signed, err := jwtToken.SignedString(p.key)
+	if err != nil {
+		return "", fmt.Errorf("sign provider token: %w", err)
+	}
+
+	p.token, p.issuedAt = signed, now
+
+	return p.token, nil
+}
@@ -0,0 +1,53 @@
+package app
+
+import (
+	"context"
+	"sync"
+)
+
+// FakePush is a push sent through the FakePushProvider.
+type FakePush struct {
+	PushToken
+	PushNotification
+}
+
+// FakePushProvider records the pushes in memory, it is meant for tests and
+// local development without push credentials.
+type FakePushProvider struct {
+	mu     sync.Mutex
+	pushes []FakePush
+	err    error
+}
+
+func NewFakePushProvider() *FakePushProvider {
+	return &FakePushProvider{}
+}
+
+func (p *FakePushProvider) Send(_ context.Context, token PushToken, n PushNotification) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return p.err
+	}
+
+	p.pushes = append(p.pushes, FakePush{PushToken: token, PushNotification: n})
+
+	return nil
+}
+
+// Fail makes the following pushes return err, nil restores the delivery.
+func (p *FakePushProvider) Fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.err = err
+}
+
+// Pushes returns the pushes sent, oldest first.
+func (p *FakePushProvider) Pushes() []FakePush {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]FakePush(nil), p.pushes...)
+}
@@ -0,0 +1,184 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	client "signal/internal/restclient"
+)
+
+const (
+	fcmEndpoint = "https://fcm.googleapis.com"
+	fcmScope    = "https://www.googleapis.com/auth/firebase.messaging"
+)
+
+// FCMConfig points to a Firebase project and the service account allowed
+// to send its messages.
+type FCMConfig struct {
+	ProjectID string
+	// CredentialsFile is the JSON key of the service account.
+	CredentialsFile string
+	// Endpoint replaces https://fcm.googleapis.com, for tests.
+	Endpoint string
+}
+
+type fcmCredentials struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// FCMPushProvider sends data messages through the FCM HTTP v1 API, the app
+// shows the incoming call itself. The OAuth2 access token is obtained with
+// the service account key and reused until it expires.
+type FCMPushProvider struct {
+	config      FCMConfig
+	credentials fcmCredentials
+	key         any
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+func NewFCMPushProvider(config FCMConfig) (*FCMPushProvider, error) {
+	if config.ProjectID == "" {
+		return nil, fmt.Errorf("fcm needs a project id")
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = fcmEndpoint
+	}
+
+	data, err := os.ReadFile(config.CredentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("read credentials: %w", err)
+	}
+
+	credentials := fcmCredentials{}
+	if err := json.Unmarshal(data, &credentials); err != nil {
+		return nil, fmt.Errorf("parse credentials: %w", err)
+	}
+
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(credentials.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("parse private key: %w", err)
+	}
+
+	return &FCMPushProvider{config: config, credentials: credentials, key: key}, nil
+}
+
+func (p *FCMPushProvider) Send(ctx context.Context, token PushToken, n PushNotification) error {
+	accessToken, err := p.token(ctx)
+	if err != nil {
+		return err
+	}
+
+	data := map[string]string{
+		"type":      n.Type,
+		"room":      n.Room,
+		"timestamp": strconv.FormatInt(n.Timestamp, 10),
+	}
+	for key, value := range map[string]string{
+		"roomType":    n.RoomType,
+		"callerName":  n.CallerName,
+		"callerPhoto": n.CallerPhoto,
+		"reason":      n.Reason,
+	} {
+		if value != "" {
+			data[key] = value
+		}
+	}
+	if n.CallerID != 0 {
+		data["callerId"] = strconv.FormatInt(n.CallerID, 10)
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"message": map[string]any{
+			"token": token.Token,
+			"data":  data,
+			"android": map[string]any{
+				"priority": "high",
+				"ttl":      strconv.FormatInt(int64(pushTTL/time.Second), 10) + "s",
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+accessToken)
+
+	endpoint := fmt.Sprintf("%s/v1/projects/%s/messages:send", p.config.Endpoint, url.PathEscape(p.config.ProjectID))
+
+	resp, err := client.New().PostRaw(ctx, endpoint, "application/json", body, header)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return nil
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%w: %s", ErrPushTokenInvalid, resp.Body)
+	default:
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, resp.Body)
+	}
+}
+
+// token returns the access token, it is renewed a minute before expiring.
+func (p *FCMPushProvider) token(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.accessToken != "" && time.Now().Before(p.expiresAt) {
+		return p.accessToken, nil
+	}
+
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   p.credentials.ClientEmail,
+		"scope": fcmScope,
+		"aud":   p.credentials.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(p.key)
+	if err != nil {
+		return "", fmt.Errorf("sign assertion: %w", err)
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
+
+	resp, err := client.New().PostRaw(ctx, p.credentials.TokenURI,
+		"application/x-www-form-urlencoded", []byte(form.Encode()), nil)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("access token status %d: %s", resp.StatusCode, resp.Body)
+	}
+
+	grant := struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}{}
+	if err := json.Unmarshal(resp.Body, &grant); err != nil {
+		return "", fmt.Errorf("parse access token: %w", err)
+	}
+
+	p.accessToken = grant.AccessToken
+	p.expiresAt = now.Add(time.Duration(grant.ExpiresIn)*time.Second - time.Minute)
+
+	return p.accessToken, nil
+}
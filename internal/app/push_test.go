@@ -0,0 +1,189 @@
+package app
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	internalrooms "signal/internal/rooms"
+)
+
+func TestPusher(t *testing.T) {
+	ctx := context.Background()
+
+	tokens := NewMemoryPushTokenStore()
+	require.NoError(t, tokens.Register(ctx, PushToken{UserID: 2, DeviceID: "phone", Platform: FCMPlatform, Token: "fcm-1"}))
+	require.NoError(t, tokens.Register(ctx, PushToken{UserID: 2, DeviceID: "tablet", Platform: APNsPlatform, Token: "apns-1", VoIP: true}))
+	require.NoError(t, tokens.Register(ctx, PushToken{UserID: 2, DeviceID: "phone", Platform: FCMPlatform, Token: "fcm-2"}))
+
+	provider := NewFakePushProvider()
+	pusher := NewPusher(tokens, map[string]PushProvider{FCMPlatform: provider, APNsPlatform: provider})
+
+	r := &internalrooms.Room{Name: "call", Type: internalrooms.DirectType}
+	require.NoError(t, r.AddDevice(&internalrooms.Device{Room: r, UserID: 2, ID: "tablet"}))
+
+	photo := "alice.png"
+	caller := &internalrooms.Participant{Room: r, UserID: 1, FirstName: "Alice", LastName: "Smith", Photo: &photo}
+	pusher.Ring(ctx, r, caller, []int64{2})
+
+	require.Eventually(t, func() bool { return len(provider.Pushes()) == 1 }, time.Second, time.Millisecond)
+	push := provider.Pushes()[0]
+	require.Equal(t, "fcm-2", push.Token)
+	require.Equal(t, IncomingCallPush, push.Type)
+	require.Equal(t, "call", push.Room)
+	require.Equal(t, int64(1), push.CallerID)
+	require.Equal(t, "Alice Smith", push.CallerName)
+	require.Equal(t, photo, push.CallerPhoto)
+
+	// The callee answers, its devices stop ringing once.
+	pusher.Observe(ctx, internalrooms.Event{
+		Room: "call",
+		Kind: internalrooms.NotifyKind, Event: "join",
+		Peer: &internalrooms.Participant{UserID: 2},
+	})
+	pusher.Observe(ctx, internalrooms.Event{Room: "call", Kind: internalrooms.EndKind})
+
+	require.Eventually(t, func() bool { return len(provider.Pushes()) == 3 }, time.Second, time.Millisecond)
+	for _, push := range provider.Pushes()[1:] {
+		require.Equal(t, CancelCallPush, push.Type)
+		require.Equal(t, AnsweredPushReason, push.Reason)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	require.Len(t, provider.Pushes(), 3)
+}
+
+func TestPusherUnregistersInvalidTokens(t *testing.T) {
+	ctx := context.Background()
+
+	tokens := NewMemoryPushTokenStore()
+	require.NoError(t, tokens.Register(ctx, PushToken{UserID: 2, DeviceID: "phone", Platform: FCMPlatform, Token: "fcm-1"}))
+
+	provider := NewFakePushProvider()
+	provider.Fail(fmt.Errorf("%w: gone", ErrPushTokenInvalid))
+	pusher := NewPusher(tokens, map[string]PushProvider{FCMPlatform: provider})
+
+	r := &internalrooms.Room{Name: "call"}
+	pusher.Ring(ctx, r, &internalrooms.Participant{Room: r, UserID: 1}, []int64{2})
+
+	require.Eventually(t, func() bool {
+		registered, err := tokens.Tokens(ctx, 2)
+		return err == nil && len(registered) == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestFCMPushProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			require.NoError(t, r.ParseForm())
+			require.Equal(t, "urn:ietf:params:oauth:grant-type:jwt-bearer", r.Form.Get("grant_type"))
+			require.NotEmpty(t, r.Form.Get("assertion"))
+			_, _ = w.Write([]byte(`{"access_token":"access","expires_in":3600}`))
+		case "/v1/projects/signal/messages:send":
+			require.Equal(t, "Bearer access", r.Header.Get("Authorization"))
+
+			body := struct {
+				Message struct {
+					Token string            `json:"token"`
+					Data  map[string]string `json:"data"`
+				} `json:"message"`
+			}{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			require.Equal(t, "call", body.Message.Data["room"])
+			require.Equal(t, "1", body.Message.Data["callerId"])
+
+			if body.Message.Token == "stale" {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"error":{"status":"NOT_FOUND"}}`))
+			}
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	credentials, err := json.Marshal(fcmCredentials{
+		ClientEmail: "signal@example.iam.gserviceaccount.com",
+		PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+		TokenURI:    server.URL + "/token",
+	})
+	require.NoError(t, err)
+
+	provider, err := NewFCMPushProvider(FCMConfig{
+		ProjectID:       "signal",
+		CredentialsFile: writeFile(t, "credentials.json", credentials),
+		Endpoint:        server.URL,
+	})
+	require.NoError(t, err)
+
+	n := PushNotification{Type: IncomingCallPush, Room: "call", CallerID: 1}
+	require.NoError(t, provider.Send(context.Background(), PushToken{Platform: FCMPlatform, Token: "fresh"}, n))
+	require.ErrorIs(t, provider.Send(context.Background(), PushToken{Platform: FCMPlatform, Token: "stale"}, n), ErrPushTokenInvalid)
+}
+
+func TestAPNsPushProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Contains(t, r.Header.Get("Authorization"), "bearer ")
+		require.Equal(t, "call", r.Header.Get("apns-collapse-id"))
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		switch r.URL.Path {
+		case "/3/device/voip":
+			require.Equal(t, "voip", r.Header.Get("apns-push-type"))
+			require.Equal(t, "com.example.signal.voip", r.Header.Get("apns-topic"))
+			require.JSONEq(t, `{"aps":{},"type":"incomingCall","room":"call","callerId":1,"callerName":"Alice","timestamp":0}`, string(body))
+		case "/3/device/gone":
+			w.WriteHeader(http.StatusGone)
+			_, _ = w.Write([]byte(`{"reason":"Unregistered"}`))
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	provider, err := NewAPNsPushProvider(APNsConfig{
+		KeyFile:  writeFile(t, "key.p8", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		KeyID:    "KEY",
+		TeamID:   "TEAM",
+		Topic:    "com.example.signal",
+		Endpoint: server.URL,
+	})
+	require.NoError(t, err)
+
+	n := PushNotification{Type: IncomingCallPush, Room: "call", CallerID: 1, CallerName: "Alice"}
+	require.NoError(t, provider.Send(context.Background(), PushToken{Platform: APNsPlatform, Token: "voip", VoIP: true}, n))
+	require.ErrorIs(t, provider.Send(context.Background(), PushToken{Platform: APNsPlatform, Token: "gone"}, n), ErrPushTokenInvalid)
+}
+
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	return path
+}
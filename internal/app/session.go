@@ -0,0 +1,24 @@
+package app
+
+import "context"
+
+// session is the state of a single WebSocket connection shared by the
+// handlers of its messages.
+type session struct {
+	// userID is the user the connection was authenticated as, zero until
+	// a preconnect or join with a valid token.
+	userID int64
+	// rooms are the rooms the tokens of the connection were issued for.
+	rooms map[string]bool
+	// disconnect closes the connection.
+	disconnect context.CancelFunc
+}
+
+// bind records that the connection proved to be userID in room.
+func (s *session) bind(userID int64, room string) {
+	s.userID = userID
+	if s.rooms == nil {
+		s.rooms = map[string]bool{}
+	}
+	s.rooms[room] = true
+}
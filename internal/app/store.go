@@ -0,0 +1,64 @@
+package app
+
+import (
+	"context"
+	"sync"
+
+	internalrooms "signal/internal/rooms"
+)
+
+// RoomStore keeps the rooms known to this instance.
+type RoomStore interface {
+	// Load returns the room with the given name.
+	Load(ctx context.Context, name string) (*internalrooms.Room, bool)
+	// LoadShared returns the room even if none of its connections is on
+	// this instance. Such a room is not kept, changes to it only reach the
+	// other instances through its events.
+	LoadShared(ctx context.Context, name string) (*internalrooms.Room, bool)
+	// LoadOrStore returns the existing room with the same name if present,
+	// otherwise it stores r. The loaded result is true if the room existed.
+	LoadOrStore(ctx context.Context, r *internalrooms.Room) (*internalrooms.Room, bool, error)
+	// Delete forgets the room once nobody is connected to it.
+	Delete(ctx context.Context, name string)
+	// Range calls f for every room served by this instance until f returns false.
+	Range(ctx context.Context, f func(r *internalrooms.Room) bool)
+}
+
+type MemoryRoomStore struct {
+	rooms sync.Map
+}
+
+func NewMemoryRoomStore() *MemoryRoomStore {
+	return &MemoryRoomStore{}
+}
+
+func (s *MemoryRoomStore) Load(_ context.Context, name string) (*internalrooms.Room, bool) {
+	r, ok := s.rooms.Load(name)
+	if !ok {
+		return nil, false
+	}
+
+	return r.(*internalrooms.Room), true
+}
+
+func (s *MemoryRoomStore) LoadShared(ctx context.Context, name string) (*internalrooms.Room, bool) {
+	return s.Load(ctx, name)
+}
+
+func (s *MemoryRoomStore) LoadOrStore(
+	_ context.Context,
+	r *internalrooms.Room,
+) (*internalrooms.Room, bool, error) {
+	actual, loaded := s.rooms.LoadOrStore(r.Name, r)
+	return actual.(*internalrooms.Room), loaded, nil
+}
+
+func (s *MemoryRoomStore) Delete(_ context.Context, name string) {
+	s.rooms.Delete(name)
+}
+
+func (s *MemoryRoomStore) Range(_ context.Context, f func(r *internalrooms.Room) bool) {
+	s.rooms.Range(func(_, r any) bool {
+		return f(r.(*internalrooms.Room))
+	})
+}
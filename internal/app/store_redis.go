@@ -0,0 +1,568 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ossrs/go-oryx-lib/errors"
+	"github.com/ossrs/go-oryx-lib/logger"
+	"github.com/redis/go-redis/v9"
+	internalrooms "signal/internal/rooms"
+)
+
+const (
+	redisEventsChannel = "signal:rooms"
+
+	// redisNodeTTL is how long an instance is considered alive after its
+	// last heartbeat, redisHeartbeat apart.
+	redisNodeTTL   = 30 * time.Second
+	redisHeartbeat = 10 * time.Second
+	// redisRoomTTL expires the rooms nobody serves anymore, the instances
+	// serving a room keep extending it.
+	redisRoomTTL = 2 * time.Minute
+)
+
+// RedisRoomStore shares rooms between signal instances through Redis.
+// Every instance keeps its own *rooms.Room holding the local connections
+// and mirrors of the participants connected elsewhere, kept in sync by
+// events published on a single pub/sub channel.
+//
+// Each participant is owned by the instance it is connected to. Instances
+// keep a heartbeat, the participants of an instance that stopped beating
+// are removed so that they can join again elsewhere.
+type RedisRoomStore struct {
+	client *redis.Client
+	node   string
+	local  sync.Map
+}
+
+type redisEnvelope struct {
+	Node  string              `json:"node"`
+	Event internalrooms.Event `json:"event"`
+}
+
+func NewRedisRoomStore(ctx context.Context, client *redis.Client) (*RedisRoomStore, error) {
+	node := make([]byte, 8)
+	if _, err := rand.Read(node); err != nil {
+		return nil, errors.Wrapf(err, "node id")
+	}
+
+	s := &RedisRoomStore{
+		client: client,
+		node:   hex.EncodeToString(node),
+	}
+
+	if err := s.beat(ctx); err != nil {
+		return nil, errors.Wrapf(err, "heartbeat")
+	}
+
+	sub := client.Subscribe(ctx, redisEventsChannel)
+	if _, err := sub.Receive(ctx); err != nil {
+		return nil, errors.Wrapf(err, "subscribe %s", redisEventsChannel)
+	}
+
+	go s.listen(ctx, sub)
+	go s.heartbeat(ctx)
+
+	return s, nil
+}
+
+// Load only returns rooms with connections on this instance, the others
+// are restored from Redis by LoadOrStore when a client connects.
+func (s *RedisRoomStore) Load(_ context.Context, name string) (*internalrooms.Room, bool) {
+	r, ok := s.local.Load(name)
+	if !ok {
+		return nil, false
+	}
+
+	return r.(*internalrooms.Room), true
+}
+
+func (s *RedisRoomStore) LoadShared(ctx context.Context, name string) (*internalrooms.Room, bool) {
+	if r, ok := s.Load(ctx, name); ok {
+		return r, true
+	}
+
+	values, err := s.client.HGetAll(ctx, redisRoomKey(name)).Result()
+	if err != nil {
+		logger.Wf(ctx, "Load room %s err %v", name, err)
+		return nil, false
+	}
+
+	if len(values) == 0 {
+		return nil, false
+	}
+
+	r := &internalrooms.Room{Name: name, Broker: s}
+	if err := s.restore(ctx, r, values); err != nil {
+		logger.Wf(ctx, "Restore room %s err %v", name, err)
+		return nil, false
+	}
+
+	return r, true
+}
+
+func (s *RedisRoomStore) LoadOrStore(
+	ctx context.Context,
+	r *internalrooms.Room,
+) (*internalrooms.Room, bool, error) {
+	if actual, ok := s.Load(ctx, r.Name); ok {
+		return actual, true, nil
+	}
+
+	created, err := s.client.HSetNX(ctx, redisRoomKey(r.Name), "token", r.Token).Result()
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "create room %s", r.Name)
+	}
+
+	r.Broker = s
+
+	if created {
+		pipe := s.client.TxPipeline()
+		pipe.HSet(ctx, redisRoomKey(r.Name), "type", r.Type, "maxParticipants", r.MaxParticipants, "maxScreenShares", r.MaxScreenShares)
+		pipe.Expire(ctx, redisRoomKey(r.Name), redisRoomTTL)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, false, errors.Wrapf(err, "create room %s", r.Name)
+		}
+
+		actual, loaded := s.local.LoadOrStore(r.Name, r)
+		return actual.(*internalrooms.Room), loaded, nil
+	}
+
+	values, err := s.client.HGetAll(ctx, redisRoomKey(r.Name)).Result()
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "load room %s", r.Name)
+	}
+
+	if err := s.restore(ctx, r, values); err != nil {
+		return nil, false, errors.Wrapf(err, "restore room %s", r.Name)
+	}
+
+	actual, _ := s.local.LoadOrStore(r.Name, r)
+
+	return actual.(*internalrooms.Room), true, nil
+}
+
+func (s *RedisRoomStore) Delete(ctx context.Context, name string) {
+	s.local.Delete(name)
+
+	count, err := s.client.HLen(ctx, redisParticipantsKey(name)).Result()
+	if err != nil {
+		logger.Wf(ctx, "Delete room %s err %v", name, err)
+		return
+	}
+
+	if count > 0 {
+		return
+	}
+
+	if err := s.client.Del(ctx, redisRoomKeys(name)...).Err(); err != nil {
+		logger.Wf(ctx, "Delete room %s err %v", name, err)
+	}
+}
+
+func (s *RedisRoomStore) Range(_ context.Context, f func(r *internalrooms.Room) bool) {
+	s.local.Range(func(_, r any) bool {
+		return f(r.(*internalrooms.Room))
+	})
+}
+
+// Publish records the event in the shared room state and sends it to the
+// other instances.
+func (s *RedisRoomStore) Publish(ctx context.Context, e internalrooms.Event) error {
+	payload, err := json.Marshal(redisEnvelope{Node: s.node, Event: e})
+	if err != nil {
+		return errors.Wrapf(err, "marshal")
+	}
+
+	pipe := s.client.TxPipeline()
+
+	if e.Kind == internalrooms.NotifyKind && e.Peer != nil {
+		field := strconv.FormatInt(e.Peer.UserID, 10)
+
+		if e.Event == "leave" {
+			pipe.HDel(ctx, redisParticipantsKey(e.Room), field)
+			pipe.HDel(ctx, redisOwnersKey(e.Room), field)
+		} else {
+			peer, err := json.Marshal(e.Peer)
+			if err != nil {
+				return errors.Wrapf(err, "marshal")
+			}
+			pipe.HSet(ctx, redisParticipantsKey(e.Room), field, peer)
+
+			// Mirrors are changed by moderators of other instances, they
+			// remain owned by the instance they are connected to.
+			if !e.Peer.IsRemote() {
+				pipe.HSet(ctx, redisOwnersKey(e.Room), field, s.node)
+			}
+		}
+
+		for _, key := range redisRoomKeys(e.Room) {
+			pipe.Expire(ctx, key, redisRoomTTL)
+		}
+
+		invited, err := json.Marshal(e.InvitedParticipants)
+		if err != nil {
+			return errors.Wrapf(err, "marshal")
+		}
+		pipe.HSet(ctx, redisRoomKey(e.Room), "invited", invited)
+
+		hands, err := json.Marshal(e.Hands)
+		if err != nil {
+			return errors.Wrapf(err, "marshal")
+		}
+		pipe.HSet(ctx, redisRoomKey(e.Room), "hands", hands)
+
+		if e.StartedAt != nil {
+			pipe.HSet(ctx, redisRoomKey(e.Room), "startedAt", *e.StartedAt)
+		}
+
+		if e.InitiatorID != 0 {
+			pipe.HSet(ctx, redisRoomKey(e.Room), "initiatorId", e.InitiatorID)
+		}
+	}
+
+	if e.Kind == internalrooms.InviteKind {
+		invited, err := json.Marshal(e.InvitedParticipants)
+		if err != nil {
+			return errors.Wrapf(err, "marshal")
+		}
+		pipe.HSet(ctx, redisRoomKey(e.Room), "invited", invited)
+	}
+
+	if e.Kind == internalrooms.MediaServerKind {
+		pipe.HSet(ctx, redisRoomKey(e.Room), "mediaServer", e.MediaServer)
+	}
+
+	if e.Kind == internalrooms.LockKind {
+		pipe.HSet(ctx, redisRoomKey(e.Room), "locked", e.Event == internalrooms.LockRoomEvent)
+	}
+
+	if e.Kind == internalrooms.ModeKind {
+		pipe.HSet(ctx, redisRoomKey(e.Room), "mode", e.Mode)
+	}
+
+	if e.Kind == internalrooms.EndKind {
+		pipe.Del(ctx, redisRoomKeys(e.Room)...)
+	}
+
+	pipe.Publish(ctx, redisEventsChannel, payload)
+
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// heartbeat keeps this instance alive, the rooms it serves from expiring
+// and removes the participants of the instances that died.
+func (s *RedisRoomStore) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(redisHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := s.beat(ctx); err != nil {
+			logger.Wf(ctx, "Heartbeat of node %s err %v", s.node, err)
+		}
+
+		s.reap(ctx)
+	}
+}
+
+func (s *RedisRoomStore) beat(ctx context.Context) error {
+	return s.client.Set(ctx, redisNodeKey(s.node), time.Now().Unix(), redisNodeTTL).Err()
+}
+
+// reap removes from the local rooms the participants of dead instances.
+// Only the instance that takes one out of the owners announces its leave.
+func (s *RedisRoomStore) reap(ctx context.Context) {
+	alive := map[string]bool{}
+
+	s.Range(ctx, func(r *internalrooms.Room) bool {
+		pipe := s.client.Pipeline()
+		for _, key := range redisRoomKeys(r.Name) {
+			pipe.Expire(ctx, key, redisRoomTTL)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			logger.Wf(ctx, "Extend room %s err %v", r.Name, err)
+		}
+
+		owners, err := s.client.HGetAll(ctx, redisOwnersKey(r.Name)).Result()
+		if err != nil {
+			logger.Wf(ctx, "Owners of room %s err %v", r.Name, err)
+			return true
+		}
+
+		for field, node := range owners {
+			if s.isAlive(ctx, node, alive) {
+				continue
+			}
+
+			removed, err := s.client.HDel(ctx, redisOwnersKey(r.Name), field).Result()
+			if err != nil || removed == 0 {
+				continue
+			}
+
+			logger.Wf(ctx, "Remove participant %s of %s owned by dead node %s", field, r.Name, node)
+
+			userID, err := strconv.ParseInt(field, 10, 64)
+			if err != nil {
+				continue
+			}
+
+			p, err := r.Get(userID)
+			if err != nil || !p.IsRemote() || !r.Remove(p) {
+				s.client.HDel(ctx, redisParticipantsKey(r.Name), field)
+				continue
+			}
+
+			r.Notify(ctx, p, "leave")
+		}
+
+		return true
+	})
+}
+
+// isAlive reports whether the instance owning a participant is alive,
+// alive caches the answers.
+func (s *RedisRoomStore) isAlive(ctx context.Context, node string, alive map[string]bool) bool {
+	if node == "" {
+		return false
+	}
+	if node == s.node {
+		return true
+	}
+
+	if _, ok := alive[node]; !ok {
+		exists, err := s.client.Exists(ctx, redisNodeKey(node)).Result()
+		// Participants are only dropped once Redis says so.
+		alive[node] = err != nil || exists > 0
+	}
+
+	return alive[node]
+}
+
+func (s *RedisRoomStore) listen(ctx context.Context, sub *redis.PubSub) {
+	defer sub.Close()
+
+	messages := sub.Channel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m, ok := <-messages:
+			if !ok {
+				return
+			}
+			s.receive(ctx, m.Payload)
+		}
+	}
+}
+
+func (s *RedisRoomStore) receive(ctx context.Context, payload string) {
+	envelope := redisEnvelope{}
+	if err := json.Unmarshal([]byte(payload), &envelope); err != nil {
+		logger.Wf(ctx, "Unmarshal %s err %v", payload, err)
+		return
+	}
+
+	if envelope.Node == s.node {
+		return
+	}
+
+	// Instances without local connections to the room have nothing to deliver.
+	r, ok := s.local.Load(envelope.Event.Room)
+	if !ok {
+		return
+	}
+
+	room := r.(*internalrooms.Room)
+	room.Apply(ctx, envelope.Event)
+
+	// Devices still ringing here answer through the local room.
+	if room.IsEmpty() && !room.HasLocalDevices() {
+		room.Close()
+		s.local.Delete(room.Name)
+	}
+}
+
+// restore fills a room created by another instance with the shared state.
+func (s *RedisRoomStore) restore(ctx context.Context, r *internalrooms.Room, values map[string]string) error {
+	r.Token = values["token"]
+	r.MediaServer = values["mediaServer"]
+	r.Mode = values["mode"]
+
+	if value, ok := values["locked"]; ok {
+		locked, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.Wrapf(err, "locked")
+		}
+		r.Locked = locked
+	}
+
+	if value, ok := values["type"]; ok {
+		r.Type = value
+	}
+
+	if value, ok := values["maxParticipants"]; ok {
+		maxParticipants, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.Wrapf(err, "maxParticipants")
+		}
+		r.MaxParticipants = maxParticipants
+	}
+
+	if value, ok := values["maxScreenShares"]; ok {
+		maxScreenShares, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.Wrapf(err, "maxScreenShares")
+		}
+		r.MaxScreenShares = maxScreenShares
+	}
+
+	if value, ok := values["startedAt"]; ok {
+		startedAt, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return errors.Wrapf(err, "startedAt")
+		}
+		r.StartedAt = &startedAt
+	}
+
+	if value, ok := values["initiatorId"]; ok {
+		initiatorID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return errors.Wrapf(err, "initiatorId")
+		}
+		r.InitiatorID = initiatorID
+	}
+
+	if value, ok := values["invited"]; ok {
+		if err := json.Unmarshal([]byte(value), &r.InvitedParticipants); err != nil {
+			return errors.Wrapf(err, "invited")
+		}
+		for _, invited := range r.InvitedParticipants {
+			invited.Room = r
+		}
+	}
+
+	if value, ok := values["hands"]; ok {
+		if err := json.Unmarshal([]byte(value), &r.RaisedHands); err != nil {
+			return errors.Wrapf(err, "hands")
+		}
+	}
+
+	participants, err := s.client.HGetAll(ctx, redisParticipantsKey(r.Name)).Result()
+	if err != nil {
+		return errors.Wrapf(err, "participants")
+	}
+
+	owners, err := s.client.HGetAll(ctx, redisOwnersKey(r.Name)).Result()
+	if err != nil {
+		return errors.Wrapf(err, "owners")
+	}
+
+	alive := map[string]bool{}
+	for field, value := range participants {
+		if !s.isAlive(ctx, owners[field], alive) {
+			logger.Wf(ctx, "Drop participant %s of %s owned by dead node %q", field, r.Name, owners[field])
+			s.client.HDel(ctx, redisParticipantsKey(r.Name), field)
+			s.client.HDel(ctx, redisOwnersKey(r.Name), field)
+			continue
+		}
+
+		p := &internalrooms.Participant{}
+		if err := json.Unmarshal([]byte(value), p); err != nil {
+			return errors.Wrapf(err, "participant")
+		}
+		p.Room = r
+		r.Participants = append(r.Participants, p)
+	}
+
+	return nil
+}
+
+// RedisPushTokenStore shares the push tokens between signal instances, a
+// hash per user holds a token per device.
+type RedisPushTokenStore struct {
+	client *redis.Client
+}
+
+func NewRedisPushTokenStore(client *redis.Client) *RedisPushTokenStore {
+	return &RedisPushTokenStore{client: client}
+}
+
+func (s *RedisPushTokenStore) Register(ctx context.Context, token PushToken) error {
+	value, err := json.Marshal(token)
+	if err != nil {
+		return errors.Wrapf(err, "marshal")
+	}
+
+	return s.client.HSet(ctx, redisPushTokensKey(token.UserID), redisPushTokenField(token), value).Err()
+}
+
+func (s *RedisPushTokenStore) Unregister(ctx context.Context, token PushToken) error {
+	return s.client.HDel(ctx, redisPushTokensKey(token.UserID), redisPushTokenField(token)).Err()
+}
+
+func (s *RedisPushTokenStore) Tokens(ctx context.Context, userID int64) ([]PushToken, error) {
+	values, err := s.client.HVals(ctx, redisPushTokensKey(userID)).Result()
+	if err != nil {
+		return nil, errors.Wrapf(err, "push tokens of %d", userID)
+	}
+
+	tokens := make([]PushToken, 0, len(values))
+	for _, value := range values {
+		token := PushToken{}
+		if err := json.Unmarshal([]byte(value), &token); err != nil {
+			return nil, errors.Wrapf(err, "unmarshal %s", value)
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, nil
+}
+
+func redisRoomKey(name string) string {
+	return "signal:room:" + name
+}
+
+func redisParticipantsKey(name string) string {
+	return "signal:room:" + name + ":participants"
+}
+
+// redisOwnersKey holds the instance owning each participant of the room.
+func redisOwnersKey(name string) string {
+	return "signal:room:" + name + ":owners"
+}
+
+func redisRoomKeys(name string) []string {
+	return []string{redisRoomKey(name), redisParticipantsKey(name), redisOwnersKey(name)}
+}
+
+func redisNodeKey(node string) string {
+	return "signal:node:" + node
+}
+
+func redisPushTokensKey(userID int64) string {
+	return "signal:push:" + strconv.FormatInt(userID, 10)
+}
+
+// redisPushTokenField keys the token by device, tokens registered without
+// a device by themselves.
+func redisPushTokenField(token PushToken) string {
+	if token.DeviceID != "" {
+		return "device:" + token.DeviceID
+	}
+
+	return "token:" + token.Token
+}
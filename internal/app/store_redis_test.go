@@ -0,0 +1,287 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	internalrooms "signal/internal/rooms"
+)
+
+func TestRedisRoomStore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server := miniredis.RunT(t)
+
+	nodeA, err := NewRedisRoomStore(ctx, redis.NewClient(&redis.Options{Addr: server.Addr()}))
+	require.NoError(t, err)
+
+	nodeB, err := NewRedisRoomStore(ctx, redis.NewClient(&redis.Options{Addr: server.Addr()}))
+	require.NoError(t, err)
+
+	roomA, loaded, err := nodeA.LoadOrStore(ctx, &internalrooms.Room{Name: "call", Token: "secret"})
+	require.NoError(t, err)
+	require.False(t, loaded)
+
+	alice := &internalrooms.Participant{Room: roomA, Out: internalrooms.NewQueue(internalrooms.QueueConfig{}, nil), UserID: 1}
+	require.NoError(t, roomA.Add(alice))
+	roomA.Notify(ctx, alice, "join")
+	receive(t, alice.Out)
+	require.Equal(t, "srs-1", roomA.AssignMediaServer(ctx, "", "srs-1"))
+
+	roomB, loaded, err := nodeB.LoadOrStore(ctx, &internalrooms.Room{Name: "call", Token: "other"})
+	require.NoError(t, err)
+	require.True(t, loaded)
+	require.Equal(t, "secret", roomB.Token)
+	require.Len(t, roomB.Participants, 1)
+	require.Equal(t, "srs-1", roomB.AssignedMediaServer())
+
+	bob := &internalrooms.Participant{Room: roomB, Out: internalrooms.NewQueue(internalrooms.QueueConfig{}, nil), UserID: 2}
+	require.NoError(t, roomB.Add(bob))
+	require.NotNil(t, roomB.StartedAt)
+	roomB.Notify(ctx, bob, "join")
+	receive(t, bob.Out)
+
+	response := internalrooms.NotifyResponse{}
+	require.NoError(t, json.Unmarshal(receive(t, alice.Out), &response))
+	require.Equal(t, "join", response.Message.Event)
+	require.Equal(t, int64(2), response.Message.Peer.UserID)
+	require.Len(t, response.Message.Participants, 2)
+	require.NotNil(t, response.Message.StartedAt)
+
+	roomB.Remove(bob)
+	roomB.Notify(ctx, bob, "leave")
+	nodeB.Delete(ctx, "call")
+
+	response = internalrooms.NotifyResponse{}
+	require.NoError(t, json.Unmarshal(receive(t, alice.Out), &response))
+	require.Equal(t, "leave", response.Message.Event)
+	require.Len(t, response.Message.Participants, 1)
+
+	require.True(t, server.Exists(redisRoomKey("call")))
+
+	roomA.Remove(alice)
+	roomA.Notify(ctx, alice, "leave")
+	nodeA.Delete(ctx, "call")
+
+	require.False(t, server.Exists(redisRoomKey("call")))
+}
+
+func TestRedisRoomStoreLoadShared(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server := miniredis.RunT(t)
+
+	nodeA, err := NewRedisRoomStore(ctx, redis.NewClient(&redis.Options{Addr: server.Addr()}))
+	require.NoError(t, err)
+
+	nodeB, err := NewRedisRoomStore(ctx, redis.NewClient(&redis.Options{Addr: server.Addr()}))
+	require.NoError(t, err)
+
+	roomA, _, err := nodeA.LoadOrStore(ctx, &internalrooms.Room{Name: "call", Token: "secret"})
+	require.NoError(t, err)
+
+	kicked := make(chan struct{})
+	alice := &internalrooms.Participant{
+		Room:       roomA,
+		Out:        internalrooms.NewQueue(internalrooms.QueueConfig{}, nil),
+		Disconnect: func() { close(kicked) },
+		UserID:     1,
+	}
+	require.NoError(t, roomA.Add(alice))
+	roomA.Notify(ctx, alice, "join")
+
+	_, loaded := nodeB.Load(ctx, "call")
+	require.False(t, loaded)
+
+	// The admin API of an instance without connections to the room.
+	roomB, loaded := nodeB.LoadShared(ctx, "call")
+	require.True(t, loaded)
+	require.Len(t, roomB.Participants, 1)
+
+	_, loaded = nodeB.Load(ctx, "call")
+	require.False(t, loaded)
+
+	require.True(t, roomB.Kick(ctx, alice.UserID))
+
+	select {
+	case <-kicked:
+	case <-time.After(time.Second):
+		t.Fatal("participant was not kicked")
+	}
+
+	_, loaded = nodeB.LoadShared(ctx, "other")
+	require.False(t, loaded)
+}
+
+func TestRedisRoomStoreDeadNode(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server := miniredis.RunT(t)
+
+	ctxA, crash := context.WithCancel(ctx)
+	nodeA, err := NewRedisRoomStore(ctxA, redis.NewClient(&redis.Options{Addr: server.Addr()}))
+	require.NoError(t, err)
+
+	nodeB, err := NewRedisRoomStore(ctx, redis.NewClient(&redis.Options{Addr: server.Addr()}))
+	require.NoError(t, err)
+
+	roomA, _, err := nodeA.LoadOrStore(ctx, &internalrooms.Room{Name: "call", Token: "secret"})
+	require.NoError(t, err)
+
+	alice := &internalrooms.Participant{Room: roomA, Out: internalrooms.NewQueue(internalrooms.QueueConfig{}, nil), UserID: 1}
+	require.NoError(t, roomA.Add(alice))
+	roomA.Notify(ctx, alice, "join")
+
+	// Rooms nobody serves anymore expire.
+	for _, key := range redisRoomKeys("call") {
+		require.Positive(t, server.TTL(key))
+	}
+
+	roomB, _, err := nodeB.LoadOrStore(ctx, &internalrooms.Room{Name: "call", Token: "secret"})
+	require.NoError(t, err)
+	bob := &internalrooms.Participant{Room: roomB, Out: internalrooms.NewQueue(internalrooms.QueueConfig{}, nil), UserID: 2}
+	require.NoError(t, roomB.Add(bob))
+	roomB.Notify(ctx, bob, "join")
+	receive(t, bob.Out)
+	require.Len(t, roomB.Participants, 2)
+
+	// Node A crashes, its heartbeat expires.
+	crash()
+	require.NoError(t, nodeB.beat(ctx))
+	server.FastForward(redisNodeTTL + time.Second)
+	require.NoError(t, nodeB.beat(ctx))
+
+	nodeB.reap(ctx)
+
+	response := internalrooms.NotifyResponse{}
+	require.NoError(t, json.Unmarshal(receive(t, bob.Out), &response))
+	require.Equal(t, "leave", response.Message.Event)
+	require.Equal(t, alice.UserID, response.Message.Peer.UserID)
+	require.Len(t, roomB.Participants, 1)
+
+	require.Empty(t, server.HGet(redisOwnersKey("call"), "1"))
+	require.Empty(t, server.HGet(redisParticipantsKey("call"), "1"))
+
+	// Alice joins again through another instance.
+	nodeC, err := NewRedisRoomStore(ctx, redis.NewClient(&redis.Options{Addr: server.Addr()}))
+	require.NoError(t, err)
+	roomC, loaded, err := nodeC.LoadOrStore(ctx, &internalrooms.Room{Name: "call"})
+	require.NoError(t, err)
+	require.True(t, loaded)
+	require.Len(t, roomC.Participants, 1)
+	require.NoError(t, roomC.Add(&internalrooms.Participant{Room: roomC, UserID: 1}))
+}
+
+func TestRedisRoomStoreRestoreDropsDeadOwners(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server := miniredis.RunT(t)
+
+	node, err := NewRedisRoomStore(ctx, redis.NewClient(&redis.Options{Addr: server.Addr()}))
+	require.NoError(t, err)
+
+	// A crashed instance left alice behind.
+	server.HSet(redisRoomKey("call"), "token", "secret")
+	server.HSet(redisParticipantsKey("call"), "1", `{"userId":1}`)
+	server.HSet(redisOwnersKey("call"), "1", "dead")
+
+	r, loaded, err := node.LoadOrStore(ctx, &internalrooms.Room{Name: "call"})
+	require.NoError(t, err)
+	require.True(t, loaded)
+	require.Empty(t, r.Participants)
+	require.Empty(t, server.HGet(redisParticipantsKey("call"), "1"))
+}
+
+func TestRedisRoomStoreKeepsRoomOfLocalDevices(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server := miniredis.RunT(t)
+
+	node, err := NewRedisRoomStore(ctx, redis.NewClient(&redis.Options{Addr: server.Addr()}))
+	require.NoError(t, err)
+
+	r, _, err := node.LoadOrStore(ctx, &internalrooms.Room{Name: "call", Token: "secret"})
+	require.NoError(t, err)
+
+	phone := &internalrooms.Device{Room: r, Out: internalrooms.NewQueue(internalrooms.QueueConfig{}, nil), UserID: 2, ID: "phone"}
+	require.NoError(t, r.AddDevice(phone))
+
+	// The caller joins and leaves through another instance.
+	for _, event := range []string{"join", "leave"} {
+		payload, err := json.Marshal(redisEnvelope{
+			Node: "other",
+			Event: internalrooms.Event{
+				Kind:  internalrooms.NotifyKind,
+				Room:  "call",
+				Event: event,
+				Peer:  &internalrooms.Participant{UserID: 1},
+			},
+		})
+		require.NoError(t, err)
+		node.receive(ctx, string(payload))
+	}
+	require.True(t, r.IsEmpty())
+
+	// The phone still rings and answers in the same room.
+	loaded, ok := node.Load(ctx, "call")
+	require.True(t, ok)
+	require.Same(t, r, loaded)
+	_, err = loaded.Decline(phone.UserID, phone.ID)
+	require.NoError(t, err)
+
+	r.RemoveDevice(phone)
+	payload, err := json.Marshal(redisEnvelope{Node: "other", Event: internalrooms.Event{Kind: internalrooms.SpeakKind, Room: "call", UserID: 1}})
+	require.NoError(t, err)
+	node.receive(ctx, string(payload))
+
+	_, ok = node.Load(ctx, "call")
+	require.False(t, ok)
+}
+
+func receive(t *testing.T, q *internalrooms.Queue) []byte {
+	t.Helper()
+
+	for {
+		if m, ok := q.Pop(); ok {
+			return m
+		}
+
+		select {
+		case <-q.Ready():
+		case <-time.After(time.Second):
+			t.Fatal("message was not delivered")
+		}
+	}
+}
+
+func TestRedisPushTokenStore(t *testing.T) {
+	ctx := context.Background()
+
+	server := miniredis.RunT(t)
+	s := NewRedisPushTokenStore(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+
+	require.NoError(t, s.Register(ctx, PushToken{UserID: 2, DeviceID: "phone", Platform: FCMPlatform, Token: "fcm-1"}))
+	require.NoError(t, s.Register(ctx, PushToken{UserID: 2, DeviceID: "phone", Platform: FCMPlatform, Token: "fcm-2"}))
+	require.NoError(t, s.Register(ctx, PushToken{UserID: 2, Platform: APNsPlatform, Token: "apns-1", VoIP: true}))
+
+	tokens, err := s.Tokens(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, tokens, 2)
+	require.ElementsMatch(t, []string{"fcm-2", "apns-1"}, []string{tokens[0].Token, tokens[1].Token})
+
+	require.NoError(t, s.Unregister(ctx, PushToken{UserID: 2, DeviceID: "phone", Token: "fcm-2"}))
+	tokens, err = s.Tokens(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	require.True(t, tokens[0].VoIP)
+}
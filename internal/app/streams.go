@@ -0,0 +1,37 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/ossrs/go-oryx-lib/logger"
+	internalrooms "signal/internal/rooms"
+)
+
+// streamSessions stops the media server sessions of the streams that ended
+// on this instance, whether unpublished or left behind by a participant.
+type streamSessions struct {
+	a *App
+}
+
+func (s streamSessions) Observe(ctx context.Context, e internalrooms.Event) {
+	if e.Kind != internalrooms.NotifyKind || e.Event != internalrooms.StreamEndedEvent || e.Session == nil {
+		return
+	}
+
+	session := *e.Session
+	ctx = context.WithoutCancel(ctx)
+
+	// Observers must not block on the media server.
+	go func() {
+		start := time.Now()
+		err := s.a.mediaServers.Unpublish(ctx, session.MediaServer, session.ID)
+		s.a.observeMediaServer("unpublish", start, err)
+		if err != nil {
+			logger.Wf(ctx, "Unpublish session %v of %v on %v err %+v", session.ID, e.Room, session.MediaServer, err)
+			return
+		}
+
+		logger.Tf(ctx, "Unpublish session %v of %v on %v ok", session.ID, e.Room, session.MediaServer)
+	}()
+}
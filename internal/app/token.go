@@ -0,0 +1,86 @@
+package app
+
+import (
+	"crypto/rsa"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ossrs/go-oryx-lib/errors"
+)
+
+// TokenClaims are the claims our backend puts into call tokens.
+type TokenClaims struct {
+	Room   string `json:"room"`
+	UserID int64  `json:"userId"`
+	// Role is given to the participant, e.g. moderator.
+	Role string `json:"role,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// TokenVerifier checks that a token grants the user access to the room.
+type TokenVerifier interface {
+	Verify(token string, room string, userID int64) (*TokenClaims, error)
+}
+
+// JWTVerifier accepts JWTs signed with an HMAC secret or an RSA key.
+type JWTVerifier struct {
+	hmacSecret []byte
+	rsaKey     *rsa.PublicKey
+	parser     *jwt.Parser
+}
+
+func NewJWTVerifier(hmacSecret string, rsaPublicKey string) (*JWTVerifier, error) {
+	v := &JWTVerifier{}
+	var methods []string
+
+	if hmacSecret != "" {
+		v.hmacSecret = []byte(hmacSecret)
+		methods = append(methods, "HS256", "HS384", "HS512")
+	}
+
+	if rsaPublicKey != "" {
+		key, err := jwt.ParseRSAPublicKeyFromPEM([]byte(rsaPublicKey))
+		if err != nil {
+			return nil, errors.Wrapf(err, "rsa public key")
+		}
+		v.rsaKey = key
+		methods = append(methods, "RS256", "RS384", "RS512")
+	}
+
+	if len(methods) == 0 {
+		return nil, errors.Errorf("no token keys configured")
+	}
+
+	v.parser = jwt.NewParser(jwt.WithValidMethods(methods), jwt.WithExpirationRequired())
+
+	return v, nil
+}
+
+func (v *JWTVerifier) Verify(token string, room string, userID int64) (*TokenClaims, error) {
+	claims := &TokenClaims{}
+
+	_, err := v.parser.ParseWithClaims(token, claims, v.key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse token")
+	}
+
+	if claims.Room != room {
+		return nil, errors.Errorf("token is not valid for room %s", room)
+	}
+
+	if claims.UserID != userID {
+		return nil, errors.Errorf("token is not valid for user %d", userID)
+	}
+
+	return claims, nil
+}
+
+func (v *JWTVerifier) key(token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		return v.hmacSecret, nil
+	case *jwt.SigningMethodRSA:
+		return v.rsaKey, nil
+	default:
+		return nil, errors.Errorf("unexpected signing method %v", token.Header["alg"])
+	}
+}
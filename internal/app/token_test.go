@@ -0,0 +1,90 @@
+package app
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWTVerifier(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+	publicKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	verifier, err := NewJWTVerifier("secret", string(publicKey))
+	require.NoError(t, err)
+
+	sign := func(method jwt.SigningMethod, key interface{}, room string, userID int64, ttl time.Duration) string {
+		claims := TokenClaims{
+			Room:   room,
+			UserID: userID,
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			},
+		}
+
+		token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		require.NoError(t, err)
+
+		return token
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{
+			name:  "HMAC",
+			token: sign(jwt.SigningMethodHS256, []byte("secret"), "call", 1, time.Minute),
+			valid: true,
+		},
+		{
+			name:  "RSA",
+			token: sign(jwt.SigningMethodRS256, rsaKey, "call", 1, time.Minute),
+			valid: true,
+		},
+		{
+			name:  "Wrong secret",
+			token: sign(jwt.SigningMethodHS256, []byte("other"), "call", 1, time.Minute),
+		},
+		{
+			name:  "Expired",
+			token: sign(jwt.SigningMethodHS256, []byte("secret"), "call", 1, -time.Minute),
+		},
+		{
+			name:  "Other room",
+			token: sign(jwt.SigningMethodHS256, []byte("secret"), "other", 1, time.Minute),
+		},
+		{
+			name:  "Other user",
+			token: sign(jwt.SigningMethodHS256, []byte("secret"), "call", 2, time.Minute),
+		},
+		{
+			name:  "Not a token",
+			token: "secret",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := verifier.Verify(tt.token, "call", 1)
+			if !tt.valid {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, int64(1), claims.UserID)
+		})
+	}
+}
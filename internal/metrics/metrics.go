@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "signal"
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	Actions             *prometheus.CounterVec
+	Errors              *prometheus.CounterVec
+	ActionDuration      *prometheus.HistogramVec
+	MediaServerDuration *prometheus.HistogramVec
+	Connects            prometheus.Counter
+	Disconnects         prometheus.Counter
+	SendDrops           *prometheus.CounterVec
+	Evictions           prometheus.Counter
+}
+
+// RoomStats is a snapshot of the rooms served by this instance.
+type RoomStats struct {
+	Rooms        int
+	Participants int
+	Devices      int
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		Actions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "actions_total",
+			Help:      "Handled client actions.",
+		}, []string{"action"}),
+		Errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "errors_total",
+			Help:      "Errors reported to clients.",
+		}, []string{"action", "code"}),
+		ActionDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "action_duration_seconds",
+			Help:      "Time spent handling client actions.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"action"}),
+		MediaServerDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "media_server_request_duration_seconds",
+			Help:      "Duration of requests to the media server.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"endpoint", "result"}),
+		Connects: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "websocket_connects_total",
+			Help:      "Accepted WebSocket connections.",
+		}),
+		Disconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "websocket_disconnects_total",
+			Help:      "Closed WebSocket connections.",
+		}),
+		SendDrops: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "send_drops_total",
+			Help:      "Messages not sent to clients, full queue or replaced by a newer one.",
+		}, []string{"reason"}),
+		Evictions: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "slow_consumer_evictions_total",
+			Help:      "Connections closed because they could not keep up with their messages.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.Actions,
+		m.Errors,
+		m.ActionDuration,
+		m.MediaServerDuration,
+		m.Connects,
+		m.Disconnects,
+		m.SendDrops,
+		m.Evictions,
+	)
+
+	return m
+}
+
+// RegisterRooms exposes gauges computed from the rooms on every scrape.
+func (m *Metrics) RegisterRooms(stats func() RoomStats) {
+	m.registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "rooms",
+			Help:      "Active rooms.",
+		}, func() float64 {
+			return float64(stats().Rooms)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "participants",
+			Help:      "Participants connected to this instance.",
+		}, func() float64 {
+			return float64(stats().Participants)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "devices",
+			Help:      "Preconnected devices connected to this instance.",
+		}, func() float64 {
+			return float64(stats().Devices)
+		}),
+	)
+}
+
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
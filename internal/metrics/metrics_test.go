@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	m := New()
+	m.RegisterRooms(func() RoomStats {
+		return RoomStats{Rooms: 2, Participants: 3, Devices: 1}
+	})
+
+	m.Actions.WithLabelValues("join").Inc()
+	m.Errors.WithLabelValues("join", "invalidToken").Inc()
+
+	recorder := httptest.NewRecorder()
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := recorder.Body.String()
+	require.Contains(t, body, "signal_rooms 2")
+	require.Contains(t, body, "signal_participants 3")
+	require.Contains(t, body, "signal_devices 1")
+	require.Contains(t, body, `signal_actions_total{action="join"} 1`)
+	require.Contains(t, body, `signal_errors_total{action="join",code="invalidToken"} 1`)
+}
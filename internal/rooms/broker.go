@@ -0,0 +1,228 @@
+package rooms
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/ossrs/go-oryx-lib/logger"
+)
+
+const (
+	NotifyKind     string = "notify"
+	PreconnectKind string = "preconnect"
+	SpeakKind      string = "speak"
+	EndKind        string = "end"
+	KickKind       string = "kick"
+	// MediaServerKind moves the room to another media server node.
+	MediaServerKind string = "mediaServer"
+	// ModeKind sets the media mode of the room.
+	ModeKind string = "mode"
+	// RelayKind carries an offer, answer or ICE candidate to a participant
+	// connected to another instance.
+	RelayKind string = "relay"
+	// RemoveKind makes a participant connected to another instance leave.
+	RemoveKind string = "remove"
+	// LockKind locks or unlocks the room.
+	LockKind string = "lock"
+	// InviteKind replaces the invitations after one was cancelled, expired
+	// or changed status.
+	InviteKind string = "invite"
+	// ChatKind carries a chat message or a receipt.
+	ChatKind string = "chat"
+	// CustomKind carries a payload of a client.
+	CustomKind string = "custom"
+	// ReactionKind carries an ephemeral reaction.
+	ReactionKind string = "reaction"
+	// StartKind and EmptyKind are only observed, never replicated.
+	StartKind string = "start"
+	EmptyKind string = "empty"
+)
+
+// Event is a room notification replicated to other signal instances.
+type Event struct {
+	Room                string                `json:"room"`
+	Kind                string                `json:"kind"`
+	Event               string                `json:"event"`
+	Peer                *Participant          `json:"peer,omitempty"`
+	Device              *Device               `json:"device,omitempty"`
+	InvitedParticipants []*InvitedParticipant `json:"invitedParticipants"`
+	StartedAt           *int64                `json:"startedAt,omitempty"`
+	UserID              int64                 `json:"userId,omitempty"`
+	Level               float64               `json:"level,omitempty"`
+	InitiatorID         int64                 `json:"initiatorId,omitempty"`
+	Reason              string                `json:"reason,omitempty"`
+	MediaServer         string                `json:"mediaServer,omitempty"`
+	Mode                string                `json:"mode,omitempty"`
+	TargetUserID        int64                 `json:"targetUserId,omitempty"`
+	SDP                 string                `json:"sdp,omitempty"`
+	Candidate           json.RawMessage       `json:"candidate,omitempty"`
+	ModeratorID         int64                 `json:"moderatorId,omitempty"`
+	Chat                *ChatMessage          `json:"chat,omitempty"`
+	Receipt             *ChatReceipt          `json:"receipt,omitempty"`
+	TargetUserIDs       []int64               `json:"targetUserIds,omitempty"`
+	Payload             json.RawMessage       `json:"payload,omitempty"`
+	Hands               []RaisedHand          `json:"hands"`
+	Reaction            string                `json:"reaction,omitempty"`
+	Stream              string                `json:"stream,omitempty"`
+	// Session is only observed by the instance that negotiated it.
+	Session *StreamSession `json:"-"`
+}
+
+// Broker delivers room events to the other instances sharing the room.
+type Broker interface {
+	Publish(ctx context.Context, e Event) error
+}
+
+// Observer is told about the events that happen on this instance. It is
+// called synchronously and must not block.
+type Observer interface {
+	Observe(ctx context.Context, e Event)
+}
+
+// Apply mirrors an event received from another instance into the room
+// and delivers it to the participants and devices connected locally.
+func (r *Room) Apply(ctx context.Context, e Event) {
+	switch e.Kind {
+	case NotifyKind:
+		if e.Peer == nil {
+			return
+		}
+		r.notify(ctx, r.applyPeer(e), e.Event, e.Stream)
+	case PreconnectKind:
+		if e.Device == nil {
+			return
+		}
+		r.notifyPreconnect(ctx, r.applyDevice(e.Device), e.Event)
+	case SpeakKind:
+		r.speak(e.UserID, e.Level, false)
+	case EndKind:
+		r.end(ctx, e.UserID, e.Reason)
+	case KickKind:
+		if p, err := r.Get(e.UserID); err == nil && !p.IsRemote() {
+			p.Kick()
+		}
+	case MediaServerKind:
+		r.Lock.Lock()
+		r.MediaServer = e.MediaServer
+		r.Lock.Unlock()
+	case ModeKind:
+		r.Lock.Lock()
+		r.Mode = e.Mode
+		r.Lock.Unlock()
+	case RemoveKind:
+		if p, err := r.Get(e.UserID); err == nil && !p.IsRemote() {
+			r.removeParticipant(p, e.ModeratorID)
+		}
+	case LockKind:
+		r.setLocked(e.Event == LockRoomEvent, e.ModeratorID)
+	case InviteKind:
+		r.applyInvite(e)
+	case ChatKind:
+		r.applyChat(e)
+	case CustomKind:
+		r.deliverCustom(e)
+	case ReactionKind:
+		r.react(e.UserID, e.Reaction)
+	case RelayKind:
+		if p, err := r.Get(e.TargetUserID); err == nil && !p.IsRemote() {
+			r.relay(ctx, p, e.UserID, e.Event, e.SDP, e.Candidate)
+		}
+	}
+}
+
+func (r *Room) observe(ctx context.Context, e Event) {
+	e.Room = r.Name
+
+	if r.Observer != nil {
+		r.Observer.Observe(ctx, e)
+	}
+}
+
+func (r *Room) publish(ctx context.Context, e Event) {
+	r.observe(ctx, e)
+
+	if r.Broker == nil {
+		return
+	}
+
+	e.Room = r.Name
+	if err := r.Broker.Publish(ctx, e); err != nil {
+		logger.Wf(ctx, "Publish %v event %v err %v", e.Kind, e.Event, err)
+	}
+}
+
+// applyPeer updates the mirror of a participant connected to another
+// instance. Mirrors have no Out channel and are never written to.
+func (r *Room) applyPeer(e Event) *Participant {
+	r.Lock.Lock()
+	defer r.Lock.Unlock()
+
+	r.InvitedParticipants = e.InvitedParticipants
+	for _, invited := range r.InvitedParticipants {
+		invited.Room = r
+	}
+	r.RaisedHands = e.Hands
+
+	if e.StartedAt != nil {
+		r.StartedAt = e.StartedAt
+	}
+
+	if e.InitiatorID != 0 {
+		r.InitiatorID = e.InitiatorID
+	}
+
+	for i, participant := range r.Participants {
+		if participant.UserID != e.Peer.UserID {
+			continue
+		}
+
+		if e.Event == "leave" {
+			r.Participants = append(r.Participants[:i], r.Participants[i+1:]...)
+			return participant
+		}
+
+		if participant.IsRemote() {
+			participant.copyState(e.Peer)
+		} else if isForced(e.Event) {
+			participant.IsMicroOn = e.Peer.IsMicroOn
+			participant.CameraType = e.Peer.CameraType
+		}
+
+		return participant
+	}
+
+	peer := e.Peer
+	peer.Room = r
+	peer.Out = nil
+
+	if e.Event != "leave" {
+		r.Participants = append(r.Participants, peer)
+	}
+
+	return peer
+}
+
+func (r *Room) applyDevice(d *Device) *Device {
+	r.Lock.Lock()
+	defer r.Lock.Unlock()
+
+	device, group := r.device(d.ID)
+	if device == nil {
+		device = d
+		device.Room = r
+		device.Out = nil
+
+		group = r.group(d.UserID)
+		if group == nil {
+			group = &DeviceGroup{UserID: d.UserID}
+			r.DeviceGroups = append(r.DeviceGroups, group)
+		}
+		group.Devices = append(group.Devices, device)
+	} else if device.Out == nil {
+		device.Status = d.Status
+	}
+
+	group.update(device)
+
+	return device
+}
@@ -0,0 +1,289 @@
+package rooms
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	ChatEvent    string = "chat"
+	ChatAckEvent string = "chatAck"
+
+	// DeliveredReceipt and ReadReceipt are the statuses a recipient acks a
+	// message with.
+	DeliveredReceipt string = "delivered"
+	ReadReceipt      string = "read"
+)
+
+var (
+	ErrMessageTooLong = errors.New("message is too long")
+	ErrRateLimited    = errors.New("rate limited")
+)
+
+// ChatConfig bounds the chat of a room.
+type ChatConfig struct {
+	// HistorySize is the number of messages kept for late joiners.
+	HistorySize int
+	// MaxLength is the longest text of a message, in bytes.
+	MaxLength int
+	// Rate messages are allowed to every participant per RateWindow.
+	Rate       int
+	RateWindow time.Duration
+}
+
+// ChatMessage is a text message, to the whole room or to TargetUserID
+// only.
+type ChatMessage struct {
+	ID           string `json:"id"`
+	UserID       int64  `json:"userId"`
+	TargetUserID int64  `json:"targetUserId,omitempty"`
+	Text         string `json:"text"`
+	// SentAt is in unix milliseconds.
+	SentAt int64 `json:"sentAt"`
+}
+
+// ChatReceipt acknowledges a message to its sender.
+type ChatReceipt struct {
+	MessageID string `json:"messageId"`
+	UserID    int64  `json:"userId"`
+	Status    string `json:"status"`
+}
+
+// visibleTo reports whether the user may read the message.
+func (m *ChatMessage) visibleTo(userID int64) bool {
+	return m.TargetUserID == 0 || m.UserID == userID || m.TargetUserID == userID
+}
+
+// chat keeps the recent messages of a room and limits their rate.
+type chat struct {
+	config  ChatConfig
+	limiter *rateLimiter
+
+	mu      sync.Mutex
+	history []*ChatMessage
+}
+
+func newChat(config ChatConfig) *chat {
+	if config.HistorySize <= 0 {
+		config.HistorySize = 100
+	}
+	if config.MaxLength <= 0 {
+		config.MaxLength = 4096
+	}
+	if config.Rate <= 0 {
+		config.Rate = 10
+	}
+	if config.RateWindow <= 0 {
+		config.RateWindow = 10 * time.Second
+	}
+
+	return &chat{
+		config:  config,
+		limiter: newRateLimiter(config.Rate, config.RateWindow),
+	}
+}
+
+// add keeps the message, it reports false if it was already kept.
+func (c *chat) add(m *ChatMessage) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, message := range c.history {
+		if message.ID == m.ID {
+			return false
+		}
+	}
+
+	if len(c.history) == c.config.HistorySize {
+		c.history = c.history[1:]
+	}
+	c.history = append(c.history, m)
+
+	return true
+}
+
+func (c *chat) find(messageID string) *ChatMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, message := range c.history {
+		if message.ID == messageID {
+			return message
+		}
+	}
+
+	return nil
+}
+
+func (r *Room) chat() *chat {
+	r.Lock.Lock()
+	defer r.Lock.Unlock()
+
+	if r.chatState == nil {
+		r.chatState = newChat(r.ChatConfig)
+	}
+
+	return r.chatState
+}
+
+// Chat sends a text message of the participant to the room, or to the
+// target only if it is not 0. The message gets its id and time here.
+func (r *Room) Chat(ctx context.Context, from int64, to int64, text string) (*ChatMessage, error) {
+	c := r.chat()
+
+	if len(text) > c.config.MaxLength {
+		return nil, fmt.Errorf("%w: %d bytes from %d", ErrMessageTooLong, len(text), from)
+	}
+
+	if to != 0 {
+		if _, err := r.Get(to); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	if !c.limiter.allow(from, now) {
+		return nil, fmt.Errorf("%w: %d sent %d messages in %v", ErrRateLimited, from, c.config.Rate, c.config.RateWindow)
+	}
+
+	m := &ChatMessage{
+		ID:           newMessageID(),
+		UserID:       from,
+		TargetUserID: to,
+		Text:         text,
+		SentAt:       now.UnixMilli(),
+	}
+	c.add(m)
+
+	r.deliverChat(m)
+
+	r.publish(ctx, Event{
+		Kind:  ChatKind,
+		Event: ChatEvent,
+		Chat:  m,
+	})
+
+	return m, nil
+}
+
+// ChatHistory returns the recent messages the user may read, oldest first.
+func (r *Room) ChatHistory(userID int64) []*ChatMessage {
+	c := r.chat()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	history := make([]*ChatMessage, 0, len(c.history))
+	for _, message := range c.history {
+		if message.visibleTo(userID) {
+			history = append(history, message)
+		}
+	}
+
+	return history
+}
+
+// AckChat tells the sender of the message that the user received or read
+// it. It reports false if the message is unknown or not for the user.
+func (r *Room) AckChat(ctx context.Context, userID int64, messageID string, status string) bool {
+	m := r.chat().find(messageID)
+	if m == nil || m.UserID == userID || !m.visibleTo(userID) {
+		return false
+	}
+
+	receipt := &ChatReceipt{MessageID: messageID, UserID: userID, Status: status}
+
+	sender, err := r.Get(m.UserID)
+	if err != nil {
+		// The sender left, nobody is waiting for the receipt.
+		return true
+	}
+
+	if !sender.IsRemote() {
+		r.deliverReceipt(sender, receipt)
+		return true
+	}
+
+	r.publish(ctx, Event{
+		Kind:         ChatKind,
+		Event:        ChatAckEvent,
+		TargetUserID: m.UserID,
+		Receipt:      receipt,
+	})
+
+	return true
+}
+
+// applyChat mirrors a message or a receipt of another instance.
+func (r *Room) applyChat(e Event) {
+	switch {
+	case e.Event == ChatEvent && e.Chat != nil:
+		if r.chat().add(e.Chat) {
+			r.deliverChat(e.Chat)
+		}
+	case e.Event == ChatAckEvent && e.Receipt != nil:
+		if sender, err := r.Get(e.TargetUserID); err == nil && !sender.IsRemote() {
+			r.deliverReceipt(sender, e.Receipt)
+		}
+	}
+}
+
+// deliverChat sends the message to the local participants it is for,
+// except its sender who has it in the chat response.
+func (r *Room) deliverChat(m *ChatMessage) {
+	var participants []*Participant
+	func() {
+		r.Lock.RLock()
+		defer r.Lock.RUnlock()
+		participants = append(participants, r.Participants...)
+	}()
+
+	message, err := json.Marshal(NotifyChatResponse{
+		NotifyChatMessage{
+			Action: "notify",
+			Event:  ChatEvent,
+			Chat:   m,
+		},
+	})
+	if err != nil {
+		return
+	}
+
+	for _, participant := range participants {
+		if participant.UserID == m.UserID || !m.visibleTo(participant.UserID) {
+			continue
+		}
+
+		participant.Send(message)
+	}
+}
+
+func (r *Room) deliverReceipt(sender *Participant, receipt *ChatReceipt) {
+	message, err := json.Marshal(NotifyChatAckResponse{
+		NotifyChatAckMessage{
+			Action:    "notify",
+			Event:     ChatAckEvent,
+			MessageID: receipt.MessageID,
+			UserID:    receipt.UserID,
+			Status:    receipt.Status,
+		},
+	})
+	if err != nil {
+		return
+	}
+
+	sender.Send(message)
+}
+
+func newMessageID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,73 @@
+package rooms
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoomChat(t *testing.T) {
+	ctx := context.Background()
+	r := &Room{Name: "call", Type: GroupType, ChatConfig: ChatConfig{MaxLength: 16, Rate: 3, RateWindow: time.Minute}}
+
+	var participants []*Participant
+	for userID := int64(1); userID <= 3; userID++ {
+		p := &Participant{Room: r, Out: NewQueue(QueueConfig{}, nil), UserID: userID}
+		require.NoError(t, r.Add(p))
+		participants = append(participants, p)
+	}
+	alice, bob, carol := participants[0], participants[1], participants[2]
+
+	broadcast, err := r.Chat(ctx, alice.UserID, 0, "https://lo.ink")
+	require.NoError(t, err)
+	require.NotEmpty(t, broadcast.ID)
+	require.NotZero(t, broadcast.SentAt)
+
+	for _, p := range []*Participant{bob, carol} {
+		response := NotifyChatResponse{}
+		require.NoError(t, json.Unmarshal(receive(t, p.Out), &response))
+		require.Equal(t, ChatEvent, response.Message.Event)
+		require.Equal(t, broadcast, response.Message.Chat)
+	}
+	require.Zero(t, alice.Out.Len())
+
+	private, err := r.Chat(ctx, alice.UserID, bob.UserID, "psst")
+	require.NoError(t, err)
+	response := NotifyChatResponse{}
+	require.NoError(t, json.Unmarshal(receive(t, bob.Out), &response))
+	require.Equal(t, private.ID, response.Message.Chat.ID)
+	require.Zero(t, carol.Out.Len())
+
+	// Late joiners only get the messages they may read.
+	require.Equal(t, []*ChatMessage{broadcast}, r.ChatHistory(4))
+	require.Equal(t, []*ChatMessage{broadcast, private}, r.ChatHistory(bob.UserID))
+
+	require.True(t, r.AckChat(ctx, bob.UserID, private.ID, ReadReceipt))
+	receipt := NotifyChatAckResponse{}
+	require.NoError(t, json.Unmarshal(receive(t, alice.Out), &receipt))
+	require.Equal(t, NotifyChatAckMessage{
+		Action:    "notify",
+		Event:     ChatAckEvent,
+		MessageID: private.ID,
+		UserID:    bob.UserID,
+		Status:    ReadReceipt,
+	}, receipt.Message)
+
+	require.False(t, r.AckChat(ctx, carol.UserID, private.ID, ReadReceipt))
+	require.False(t, r.AckChat(ctx, alice.UserID, broadcast.ID, ReadReceipt))
+	require.False(t, r.AckChat(ctx, bob.UserID, "unknown", DeliveredReceipt))
+
+	_, err = r.Chat(ctx, bob.UserID, 0, strings.Repeat("a", 17))
+	require.ErrorIs(t, err, ErrMessageTooLong)
+	_, err = r.Chat(ctx, bob.UserID, 5, "hi")
+	require.ErrorIs(t, err, ErrParticipantNotFound)
+
+	_, err = r.Chat(ctx, alice.UserID, 0, "third")
+	require.NoError(t, err)
+	_, err = r.Chat(ctx, alice.UserID, 0, "fourth")
+	require.ErrorIs(t, err, ErrRateLimited)
+}
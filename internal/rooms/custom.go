@@ -0,0 +1,68 @@
+package rooms
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+)
+
+// CustomEvent relays the opaque payloads of the clients.
+const CustomEvent string = "custom"
+
+// Custom relays a payload of the participant to the room, or to the
+// targets only if there are any. The payload is not looked into.
+func (r *Room) Custom(ctx context.Context, from int64, to []int64, customType string, payload json.RawMessage) error {
+	for _, userID := range to {
+		if _, err := r.Get(userID); err != nil {
+			return err
+		}
+	}
+
+	e := Event{
+		Kind:          CustomKind,
+		Event:         customType,
+		UserID:        from,
+		TargetUserIDs: to,
+		Payload:       payload,
+	}
+
+	r.deliverCustom(e)
+	r.publish(ctx, e)
+
+	return nil
+}
+
+// deliverCustom sends the payload to the local participants it is for,
+// never back to its sender.
+func (r *Room) deliverCustom(e Event) {
+	var participants []*Participant
+	func() {
+		r.Lock.RLock()
+		defer r.Lock.RUnlock()
+		participants = append(participants, r.Participants...)
+	}()
+
+	message, err := json.Marshal(NotifyCustomResponse{
+		NotifyCustomMessage{
+			Action:  "notify",
+			Event:   CustomEvent,
+			Type:    e.Event,
+			UserID:  e.UserID,
+			Payload: e.Payload,
+		},
+	})
+	if err != nil {
+		return
+	}
+
+	for _, participant := range participants {
+		if participant.UserID == e.UserID {
+			continue
+		}
+		if len(e.TargetUserIDs) > 0 && !slices.Contains(e.TargetUserIDs, participant.UserID) {
+			continue
+		}
+
+		participant.Send(message)
+	}
+}
@@ -0,0 +1,43 @@
+package rooms
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoomCustom(t *testing.T) {
+	ctx := context.Background()
+	r := &Room{Name: "call", Type: GroupType}
+
+	var participants []*Participant
+	for userID := int64(1); userID <= 3; userID++ {
+		p := &Participant{Room: r, Out: NewQueue(QueueConfig{}, nil), UserID: userID}
+		require.NoError(t, r.Add(p))
+		participants = append(participants, p)
+	}
+	alice, bob, carol := participants[0], participants[1], participants[2]
+
+	payload := json.RawMessage(`{"orientation":"landscape"}`)
+	require.NoError(t, r.Custom(ctx, alice.UserID, nil, "orientation", payload))
+
+	for _, p := range []*Participant{bob, carol} {
+		response := NotifyCustomResponse{}
+		require.NoError(t, json.Unmarshal(receive(t, p.Out), &response))
+		require.Equal(t, CustomEvent, response.Message.Event)
+		require.Equal(t, "orientation", response.Message.Type)
+		require.Equal(t, alice.UserID, response.Message.UserID)
+		require.JSONEq(t, string(payload), string(response.Message.Payload))
+	}
+	require.Zero(t, alice.Out.Len())
+
+	require.NoError(t, r.Custom(ctx, alice.UserID, []int64{carol.UserID}, "poke", nil))
+	response := NotifyCustomResponse{}
+	require.NoError(t, json.Unmarshal(receive(t, carol.Out), &response))
+	require.Equal(t, "poke", response.Message.Type)
+	require.Zero(t, bob.Out.Len())
+
+	require.ErrorIs(t, r.Custom(ctx, alice.UserID, []int64{4}, "poke", nil), ErrParticipantNotFound)
+}
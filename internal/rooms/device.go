@@ -9,11 +9,18 @@ const (
 )
 
 type Device struct {
-	Room   *Room       `json:"-"`
-	Out    chan []byte `json:"-"`
-	UserID int64       `json:"userId"`
-	ID     string      `json:"id"`
-	Status string      `json:"status"`
+	Room   *Room  `json:"-"`
+	Out    *Queue `json:"-"`
+	UserID int64  `json:"userId"`
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+// Send queues a message for the device's connection.
+func (d *Device) Send(message []byte) {
+	if d.Out != nil {
+		d.Out.Push(message)
+	}
 }
 
 func (d *Device) HandleContextDone(ctx context.Context) {
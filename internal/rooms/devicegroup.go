@@ -0,0 +1,179 @@
+package rooms
+
+const (
+	RingingCallState  string = "ringing"
+	AcceptedCallState string = "accepted"
+	DeclinedCallState string = "declined"
+	BusyCallState     string = "busy"
+
+	// AnsweredElsewhereEvent stops the ringing of the other devices of a
+	// user who accepted the call.
+	AnsweredElsewhereEvent string = "answeredElsewhere"
+	// DeclinedElsewhereEvent tells the other devices of a user that the
+	// last of them declined the call.
+	DeclinedElsewhereEvent string = "declinedElsewhere"
+)
+
+// DeviceGroup holds the devices of a user and the user's answer to the
+// call. The first device to accept answers for all of them, the user
+// declined or is busy once none of them rings anymore.
+type DeviceGroup struct {
+	UserID  int64
+	State   string
+	Devices []*Device
+
+	// decidedBy is a copy of the device that set the state, it may be gone.
+	decidedBy *Device
+}
+
+// CallState is the call state of a user aggregated over its devices.
+type CallState struct {
+	UserID   int64  `json:"userId"`
+	State    string `json:"state"`
+	DeviceID string `json:"deviceId,omitempty"`
+	Devices  int    `json:"devices"`
+}
+
+// update moves the group state along with the status of one of its
+// devices, it reports whether the state changed.
+func (g *DeviceGroup) update(d *Device) bool {
+	state := g.State
+
+	switch d.Status {
+	case AcceptStatus:
+		state = AcceptedCallState
+	case DeclineStatus, BusyStatus:
+		if state != AcceptedCallState {
+			state = g.refusedState()
+		}
+	}
+
+	if state == g.State {
+		return false
+	}
+
+	decidedBy := *d
+	g.State, g.decidedBy = state, &decidedBy
+
+	return true
+}
+
+// refusedState is the state of a group whose devices all declined or are
+// busy, a single decline makes it declined. It is empty while a device
+// still rings.
+func (g *DeviceGroup) refusedState() string {
+	state := BusyCallState
+	for _, device := range g.Devices {
+		switch device.Status {
+		case BusyStatus:
+		case DeclineStatus:
+			state = DeclinedCallState
+		default:
+			return ""
+		}
+	}
+
+	return state
+}
+
+// reset forgets the answer of the user, it is invited again.
+func (g *DeviceGroup) reset() {
+	g.State, g.decidedBy = "", nil
+	for _, device := range g.Devices {
+		device.Status = ""
+	}
+}
+
+func (g *DeviceGroup) callState() CallState {
+	state := CallState{
+		UserID:  g.UserID,
+		State:   g.State,
+		Devices: len(g.Devices),
+	}
+
+	if state.State == "" {
+		state.State = RingingCallState
+	}
+
+	if g.decidedBy != nil {
+		state.DeviceID = g.decidedBy.ID
+	}
+
+	return state
+}
+
+// group returns the device group of the user, nil if it has none. The
+// room lock must be held.
+func (r *Room) group(userID int64) *DeviceGroup {
+	for _, group := range r.DeviceGroups {
+		if group.UserID == userID {
+			return group
+		}
+	}
+
+	return nil
+}
+
+// device returns the device with the id and its group. The room lock must
+// be held.
+func (r *Room) device(deviceID string) (*Device, *DeviceGroup) {
+	for _, group := range r.DeviceGroups {
+		for _, device := range group.Devices {
+			if device.ID == deviceID {
+				return device, group
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// devices returns the devices of every user. The room lock must be held.
+func (r *Room) devices() []*Device {
+	var devices []*Device
+	for _, group := range r.DeviceGroups {
+		devices = append(devices, group.Devices...)
+	}
+
+	return devices
+}
+
+// HasLocalDevices reports whether devices connected to this instance
+// preconnected to the room.
+func (r *Room) HasLocalDevices() bool {
+	r.Lock.RLock()
+	defer r.Lock.RUnlock()
+
+	for _, device := range r.devices() {
+		if device.Out != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CallState returns the call state of the user's devices.
+func (r *Room) CallState(userID int64) CallState {
+	r.Lock.RLock()
+	defer r.Lock.RUnlock()
+
+	if group := r.group(userID); group != nil {
+		return group.callState()
+	}
+
+	return CallState{UserID: userID}
+}
+
+// CallStates returns the call state of every user with devices.
+func (r *Room) CallStates() []CallState {
+	r.Lock.RLock()
+	defer r.Lock.RUnlock()
+
+	states := make([]CallState, 0, len(r.DeviceGroups))
+	for _, group := range r.DeviceGroups {
+		states = append(states, group.callState())
+	}
+
+	return states
+}
@@ -0,0 +1,95 @@
+package rooms
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoomDeviceGroups(t *testing.T) {
+	ctx := context.Background()
+	r := &Room{Name: "call", Type: GroupType}
+
+	newDevice := func(userID int64, id string) *Device {
+		d := &Device{Room: r, Out: NewQueue(QueueConfig{}, nil), UserID: userID, ID: id}
+		require.NoError(t, r.AddDevice(d))
+		return d
+	}
+	// event returns the last event the device was told about.
+	event := func(d *Device) string {
+		response := NotifyPreconnectResponse{}
+		require.NoError(t, json.Unmarshal(receive(t, d.Out), &response))
+		for d.Out.Len() > 0 {
+			require.NoError(t, json.Unmarshal(receive(t, d.Out), &response))
+		}
+		return response.Message.Event
+	}
+
+	caller := newDevice(1, "caller")
+	phone, tablet := newDevice(2, "phone"), newDevice(2, "tablet")
+	laptop, watch := newDevice(3, "laptop"), newDevice(3, "watch")
+	require.ErrorIs(t, r.AddDevice(&Device{Room: r, UserID: 2, ID: "phone"}), ErrDeviceExists)
+
+	// A busy device does not answer for the others.
+	d, err := r.Busy(phone.UserID, phone.ID)
+	require.NoError(t, err)
+	r.NotifyPreconnect(ctx, d, BusyStatus)
+	require.Equal(t, BusyStatus, event(tablet))
+	require.Equal(t, RingingCallState, r.CallState(2).State)
+
+	d, err = r.Accept(tablet.UserID, tablet.ID)
+	require.NoError(t, err)
+	r.NotifyPreconnect(ctx, d, AcceptStatus)
+	require.Equal(t, AnsweredElsewhereEvent, event(phone))
+	require.Equal(t, AcceptStatus, event(laptop))
+	require.Equal(t, CallState{UserID: 2, State: AcceptedCallState, DeviceID: "tablet", Devices: 2}, r.CallState(2))
+
+	history, err := r.GetDeviceHistory(2)
+	require.NoError(t, err)
+	require.Equal(t, "tablet", history.ID)
+
+	// The user declined once all of its devices did.
+	d, err = r.Decline(laptop.UserID, laptop.ID)
+	require.NoError(t, err)
+	r.NotifyPreconnect(ctx, d, DeclineStatus)
+	require.Equal(t, DeclineStatus, event(watch))
+	require.Equal(t, RingingCallState, r.CallState(3).State)
+
+	d, err = r.Decline(watch.UserID, watch.ID)
+	require.NoError(t, err)
+	r.NotifyPreconnect(ctx, d, DeclineStatus)
+	require.Equal(t, DeclinedElsewhereEvent, event(laptop))
+	require.Equal(t, DeclineStatus, event(caller))
+
+	// The answer outlives the device that gave it.
+	r.RemoveDevice(watch)
+	require.Equal(t, CallState{UserID: 3, State: DeclinedCallState, DeviceID: "watch", Devices: 1}, r.CallState(3))
+
+	history, err = r.GetDeviceHistory(1)
+	require.NoError(t, err)
+	require.Equal(t, "watch", history.ID)
+
+	require.Equal(t, []CallState{
+		{UserID: 1, State: RingingCallState, Devices: 1},
+		{UserID: 2, State: AcceptedCallState, DeviceID: "tablet", Devices: 2},
+		{UserID: 3, State: DeclinedCallState, DeviceID: "watch", Devices: 1},
+	}, r.CallStates())
+
+	// A busy device does not ring, the others decide.
+	pager, desk := newDevice(4, "pager"), newDevice(4, "desk")
+	_, err = r.Busy(pager.UserID, pager.ID)
+	require.NoError(t, err)
+	_, err = r.Decline(desk.UserID, desk.ID)
+	require.NoError(t, err)
+	require.Equal(t, DeclinedCallState, r.CallState(4).State)
+
+	_, err = r.Accept(1, "unknown")
+	require.ErrorIs(t, err, ErrDeviceNotFound)
+
+	// Users only answer for their own devices.
+	_, err = r.Accept(caller.UserID, laptop.ID)
+	require.ErrorIs(t, err, ErrDeviceNotFound)
+	require.Equal(t, DeclineStatus, laptop.Status)
+}
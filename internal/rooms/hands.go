@@ -0,0 +1,166 @@
+package rooms
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	RaiseHandEvent     string = "raiseHand"
+	LowerHandEvent     string = "lowerHand"
+	LowerAllHandsEvent string = "lowerAllHands"
+	ReactionEvent      string = "reaction"
+
+	// maxReactionLength bounds a reaction, in bytes. An emoji with its
+	// modifiers fits.
+	maxReactionLength = 32
+)
+
+// RaisedHand is a place in the hand queue of a room.
+type RaisedHand struct {
+	UserID   int64 `json:"userId"`
+	RaisedAt int64 `json:"raisedAt"`
+}
+
+// ReactionConfig limits the reactions of every participant.
+type ReactionConfig struct {
+	Rate       int
+	RateWindow time.Duration
+}
+
+// Hands returns the hand queue, the first raised first.
+func (r *Room) Hands() []RaisedHand {
+	r.Lock.RLock()
+	defer r.Lock.RUnlock()
+
+	return append([]RaisedHand{}, r.RaisedHands...)
+}
+
+// RaiseHand puts the participant at the end of the hand queue, it reports
+// false if its hand is already raised.
+func (r *Room) RaiseHand(ctx context.Context, p *Participant) bool {
+	raised := func() bool {
+		r.Lock.Lock()
+		defer r.Lock.Unlock()
+
+		for _, hand := range r.RaisedHands {
+			if hand.UserID == p.UserID {
+				return false
+			}
+		}
+
+		r.RaisedHands = append(r.RaisedHands, RaisedHand{UserID: p.UserID, RaisedAt: time.Now().Unix()})
+
+		return true
+	}()
+
+	if raised {
+		r.Notify(ctx, p, RaiseHandEvent)
+	}
+
+	return raised
+}
+
+// LowerHand takes the participant out of the hand queue, it reports false
+// if its hand was not raised.
+func (r *Room) LowerHand(ctx context.Context, p *Participant) bool {
+	r.Lock.Lock()
+	lowered := r.lowerHand(p.UserID)
+	r.Lock.Unlock()
+
+	if lowered {
+		r.Notify(ctx, p, LowerHandEvent)
+	}
+
+	return lowered
+}
+
+// LowerAllHands empties the hand queue on behalf of the moderator.
+func (r *Room) LowerAllHands(ctx context.Context, moderator *Participant) {
+	r.Lock.Lock()
+	r.RaisedHands = nil
+	r.Lock.Unlock()
+
+	r.Notify(ctx, moderator, LowerAllHandsEvent)
+}
+
+// lowerHand requires the room lock held.
+func (r *Room) lowerHand(userID int64) bool {
+	for i, hand := range r.RaisedHands {
+		if hand.UserID == userID {
+			r.RaisedHands = append(r.RaisedHands[:i], r.RaisedHands[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// React sends an ephemeral reaction of the participant to the room.
+func (r *Room) React(ctx context.Context, userID int64, reaction string) error {
+	if len(reaction) > maxReactionLength {
+		return fmt.Errorf("%w: reaction of %d bytes from %d", ErrMessageTooLong, len(reaction), userID)
+	}
+
+	r.Lock.Lock()
+	if r.reactions == nil {
+		config := r.ReactionConfig
+		if config.Rate <= 0 {
+			config.Rate = 5
+		}
+		if config.RateWindow <= 0 {
+			config.RateWindow = 5 * time.Second
+		}
+		r.reactions = newRateLimiter(config.Rate, config.RateWindow)
+	}
+	limiter := r.reactions
+	r.Lock.Unlock()
+
+	if !limiter.allow(userID, time.Now()) {
+		return fmt.Errorf("%w: reactions of %d", ErrRateLimited, userID)
+	}
+
+	r.react(userID, reaction)
+
+	r.publish(ctx, Event{
+		Kind:     ReactionKind,
+		UserID:   userID,
+		Reaction: reaction,
+	})
+
+	return nil
+}
+
+// react sends the reaction to the local participants but its sender. A
+// reaction is only worth its latest, it is not kept for reconnecting
+// participants.
+func (r *Room) react(userID int64, reaction string) {
+	var participants []*Participant
+	func() {
+		r.Lock.RLock()
+		defer r.Lock.RUnlock()
+		participants = append(participants, r.Participants...)
+	}()
+
+	message, err := json.Marshal(NotifyReactionResponse{
+		NotifyReactionMessage{
+			Action:   "notify",
+			Event:    ReactionEvent,
+			UserID:   userID,
+			Reaction: reaction,
+		},
+	})
+	if err != nil {
+		return
+	}
+
+	key := ReactionEvent + ":" + strconv.FormatInt(userID, 10)
+	for _, participant := range participants {
+		if participant.UserID != userID {
+			participant.SendLatest(key, message)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package rooms
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoomHands(t *testing.T) {
+	ctx := context.Background()
+	r := &Room{Name: "call", Type: GroupType}
+
+	var participants []*Participant
+	for userID := int64(1); userID <= 3; userID++ {
+		p := &Participant{Room: r, Out: NewQueue(QueueConfig{}, nil), UserID: userID}
+		require.NoError(t, r.Add(p))
+		participants = append(participants, p)
+	}
+	host, bob, carol := participants[0], participants[1], participants[2]
+
+	require.True(t, r.RaiseHand(ctx, carol))
+	require.True(t, r.RaiseHand(ctx, bob))
+	require.False(t, r.RaiseHand(ctx, carol))
+
+	hands := r.Hands()
+	require.Len(t, hands, 2)
+	require.Equal(t, []int64{carol.UserID, bob.UserID}, []int64{hands[0].UserID, hands[1].UserID})
+
+	// Everyone sees the same queue.
+	for _, p := range participants {
+		for _, expected := range [][]RaisedHand{hands[:1], hands} {
+			response := NotifyResponse{}
+			require.NoError(t, json.Unmarshal(receive(t, p.Out), &response))
+			require.Equal(t, RaiseHandEvent, response.Message.Event)
+			require.Equal(t, expected, response.Message.Hands)
+		}
+	}
+
+	require.True(t, r.LowerHand(ctx, carol))
+	require.False(t, r.LowerHand(ctx, carol))
+	response := NotifyResponse{}
+	require.NoError(t, json.Unmarshal(receive(t, host.Out), &response))
+	require.Equal(t, LowerHandEvent, response.Message.Event)
+	require.Equal(t, carol.UserID, response.Message.Peer.UserID)
+	require.Equal(t, hands[1:], response.Message.Hands)
+
+	// Leaving gives up the place in the queue.
+	require.True(t, r.Remove(bob))
+	require.Empty(t, r.Hands())
+
+	require.True(t, r.RaiseHand(ctx, carol))
+	r.LowerAllHands(ctx, host)
+	require.Empty(t, r.Hands())
+}
+
+func TestRoomReactions(t *testing.T) {
+	ctx := context.Background()
+	r := &Room{Name: "call", Type: GroupType, ReactionConfig: ReactionConfig{Rate: 2, RateWindow: time.Minute}}
+
+	alice := &Participant{Room: r, Out: NewQueue(QueueConfig{}, nil), UserID: 1}
+	bob := &Participant{Room: r, Out: NewQueue(QueueConfig{}, nil), UserID: 2}
+	require.NoError(t, r.Add(alice))
+	require.NoError(t, r.Add(bob))
+
+	require.NoError(t, r.React(ctx, alice.UserID, "👍"))
+	response := NotifyReactionResponse{}
+	require.NoError(t, json.Unmarshal(receive(t, bob.Out), &response))
+	require.Equal(t, NotifyReactionMessage{Action: "notify", Event: ReactionEvent, UserID: alice.UserID, Reaction: "👍"}, response.Message)
+	require.Zero(t, alice.Out.Len())
+
+	require.NoError(t, r.React(ctx, alice.UserID, "🎉"))
+	require.ErrorIs(t, r.React(ctx, alice.UserID, "🎉"), ErrRateLimited)
+	require.NoError(t, r.React(ctx, bob.UserID, "🎉"))
+
+	require.ErrorIs(t, r.React(ctx, bob.UserID, string(make([]byte, 33))), ErrMessageTooLong)
+}
@@ -0,0 +1,200 @@
+package rooms
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	InvitePending  string = "pending"
+	InviteRinging  string = "ringing"
+	InviteDeclined string = "declined"
+	InviteBusy     string = "busy"
+	InviteExpired  string = "expired"
+
+	CancelInviteEvent  string = "cancelInvite"
+	InviteExpiredEvent string = "inviteExpired"
+	// InviteStatusEvent tells the participants that an invitee's device
+	// started ringing, declined or was busy.
+	InviteStatusEvent string = "inviteStatus"
+)
+
+func (p *InvitedParticipant) isRinging() bool {
+	return p.InviteStatus == InvitePending || p.InviteStatus == InviteRinging
+}
+
+// inviteStatus is the invitation status that follows a call state.
+func inviteStatus(callState string) string {
+	switch callState {
+	case RingingCallState:
+		return InviteRinging
+	case DeclinedCallState:
+		return InviteDeclined
+	case BusyCallState:
+		return InviteBusy
+	default:
+		return ""
+	}
+}
+
+// UpdateInvite moves the invitation of the device's user along with the
+// call state of its devices: a connected device rings, and declining or
+// being busy ends the invitation. Participants are told about the change.
+func (r *Room) UpdateInvite(ctx context.Context, d *Device) {
+	status := inviteStatus(r.CallState(d.UserID).State)
+	if status == "" {
+		return
+	}
+
+	if !r.setInviteStatus(d.UserID, status, 0) {
+		return
+	}
+
+	r.publishInvite(ctx, InviteStatusEvent, d.UserID, 0)
+}
+
+// CancelInvite withdraws the invitation of the user, its devices stop
+// ringing. Only the inviter and the moderators may cancel it. It returns
+// false if the user is not invited.
+func (r *Room) CancelInvite(ctx context.Context, userID int64, by *Participant) (bool, error) {
+	cancelled := false
+	err := func() error {
+		r.Lock.Lock()
+		defer r.Lock.Unlock()
+
+		for i, invited := range r.InvitedParticipants {
+			if invited.UserID != userID {
+				continue
+			}
+
+			if invited.InvitedBy != by.UserID && !by.IsModerator() {
+				return fmt.Errorf("%w: %v did not invite %v", ErrNotInviter, by.UserID, userID)
+			}
+
+			r.InvitedParticipants = append(r.InvitedParticipants[:i], r.InvitedParticipants[i+1:]...)
+			cancelled = true
+			break
+		}
+
+		return nil
+	}()
+	if err != nil || !cancelled {
+		return false, err
+	}
+
+	r.publishInvite(ctx, CancelInviteEvent, userID, by.UserID)
+
+	return true, nil
+}
+
+// expireInvite ends the invitation if it is the one that was sent at
+// expiresAt and nobody answered it.
+func (r *Room) expireInvite(ctx context.Context, userID int64, expiresAt int64) {
+	if !r.setInviteStatus(userID, InviteExpired, expiresAt) {
+		return
+	}
+
+	r.publishInvite(ctx, InviteExpiredEvent, userID, 0)
+}
+
+// setInviteStatus changes the status of a ringing invitation, restricted
+// to the invitation expiring at expiresAt unless it is 0. The invitation is
+// copied, the previous one may still be marshalled outside the lock.
+func (r *Room) setInviteStatus(userID int64, status string, expiresAt int64) bool {
+	r.Lock.Lock()
+	defer r.Lock.Unlock()
+
+	if r.closed {
+		return false
+	}
+
+	for i, invited := range r.InvitedParticipants {
+		if invited.UserID != userID {
+			continue
+		}
+
+		if !invited.isRinging() || invited.InviteStatus == status ||
+			expiresAt != 0 && invited.ExpiresAt != expiresAt {
+			return false
+		}
+
+		updated := *invited
+		updated.InviteStatus = status
+		if status != InviteRinging {
+			updated.ExpiresAt = 0
+		}
+		r.InvitedParticipants[i] = &updated
+
+		return true
+	}
+
+	return false
+}
+
+func (r *Room) publishInvite(ctx context.Context, event string, userID int64, by int64) {
+	invitedParticipants := r.notifyInvite(event, userID, by)
+
+	r.publish(ctx, Event{
+		Kind:                InviteKind,
+		Event:               event,
+		UserID:              userID,
+		ModeratorID:         by,
+		InvitedParticipants: invitedParticipants,
+	})
+}
+
+// applyInvite mirrors the invitations of another instance.
+func (r *Room) applyInvite(e Event) {
+	r.Lock.Lock()
+	r.InvitedParticipants = e.InvitedParticipants
+	for _, invited := range r.InvitedParticipants {
+		invited.Room = r
+	}
+	r.Lock.Unlock()
+
+	r.notifyInvite(e.Event, e.UserID, e.ModeratorID)
+}
+
+// notifyInvite sends the invitations to the participants and the event to
+// the invitee's devices, it returns the invitations sent.
+func (r *Room) notifyInvite(event string, userID int64, by int64) []*InvitedParticipant {
+	var participants []*Participant
+	var devices []*Device
+	var invitedParticipants []*InvitedParticipant
+	func() {
+		r.Lock.RLock()
+		defer r.Lock.RUnlock()
+		participants = append(participants, r.Participants...)
+		invitedParticipants = append(invitedParticipants, r.InvitedParticipants...)
+		// The invitee's devices only learn that the invitation ended.
+		if group := r.group(userID); group != nil && event != InviteStatusEvent {
+			devices = append(devices, group.Devices...)
+		}
+	}()
+
+	response := NotifyInviteResponse{
+		NotifyInviteMessage{
+			Action:              "notify",
+			Event:               event,
+			UserID:              userID,
+			By:                  by,
+			InvitedParticipants: invitedParticipants,
+		},
+	}
+
+	message, err := json.Marshal(response)
+	if err != nil {
+		return invitedParticipants
+	}
+
+	for _, participant := range participants {
+		participant.Send(message)
+	}
+
+	for _, device := range devices {
+		device.Send(message)
+	}
+
+	return invitedParticipants
+}
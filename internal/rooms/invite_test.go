@@ -0,0 +1,100 @@
+package rooms
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoomInviteLifecycle(t *testing.T) {
+	ctx := context.Background()
+	r := &Room{Name: "call", RingTimeout: 50 * time.Millisecond}
+
+	host := &Participant{Room: r, Out: NewQueue(QueueConfig{}, nil), UserID: 1}
+	require.NoError(t, r.Add(host))
+
+	invited, err := r.AddInvited(&InvitedParticipant{Room: r, UserID: 2})
+	require.NoError(t, err)
+	require.True(t, invited)
+	require.Equal(t, InvitePending, r.InvitedParticipants[0].InviteStatus)
+	require.NotZero(t, r.InvitedParticipants[0].ExpiresAt)
+
+	d := &Device{Room: r, Out: NewQueue(QueueConfig{}, nil), UserID: 2, ID: "phone"}
+	require.NoError(t, r.AddDevice(d))
+	r.UpdateInvite(ctx, d)
+
+	invited, err = r.AddInvited(&InvitedParticipant{Room: r, UserID: 2})
+	require.NoError(t, err)
+	require.False(t, invited)
+
+	response := NotifyInviteResponse{}
+	require.NoError(t, json.Unmarshal(receive(t, host.Out), &response))
+	require.Equal(t, InviteStatusEvent, response.Message.Event)
+	require.Equal(t, InviteRinging, response.Message.InvitedParticipants[0].InviteStatus)
+	require.Zero(t, d.Out.Len())
+
+	// Nobody answers.
+	for _, out := range []*Queue{host.Out, d.Out} {
+		response = NotifyInviteResponse{}
+		require.NoError(t, json.Unmarshal(receive(t, out), &response))
+		require.Equal(t, InviteExpiredEvent, response.Message.Event)
+		require.Equal(t, int64(2), response.Message.UserID)
+		require.Equal(t, InviteExpired, response.Message.InvitedParticipants[0].InviteStatus)
+	}
+
+	// The invitation is sent again and declined.
+	invited, err = r.AddInvited(&InvitedParticipant{Room: r, UserID: 2, InvitedBy: host.UserID})
+	require.NoError(t, err)
+	require.True(t, invited)
+	_, err = r.Decline(d.UserID, d.ID)
+	require.NoError(t, err)
+	r.UpdateInvite(ctx, d)
+
+	response = NotifyInviteResponse{}
+	require.NoError(t, json.Unmarshal(receive(t, host.Out), &response))
+	require.Equal(t, InviteDeclined, response.Message.InvitedParticipants[0].InviteStatus)
+
+	// Only the inviter or a moderator withdraws the invitation.
+	viewer := &Participant{Room: r, Out: NewQueue(QueueConfig{}, nil), UserID: 3, Role: ViewerRole}
+	require.NoError(t, r.Add(viewer))
+	cancelled, err := r.CancelInvite(ctx, 2, viewer)
+	require.ErrorIs(t, err, ErrNotInviter)
+	require.False(t, cancelled)
+	require.Len(t, r.Snapshot().InvitedParticipants, 1)
+
+	cancelled, err = r.CancelInvite(ctx, 2, host)
+	require.NoError(t, err)
+	require.True(t, cancelled)
+	cancelled, err = r.CancelInvite(ctx, 2, host)
+	require.NoError(t, err)
+	require.False(t, cancelled)
+	require.Empty(t, r.Snapshot().InvitedParticipants)
+
+	response = NotifyInviteResponse{}
+	require.NoError(t, json.Unmarshal(receive(t, d.Out), &response))
+	require.Equal(t, CancelInviteEvent, response.Message.Event)
+	require.Equal(t, host.UserID, response.Message.By)
+
+	// The declined invitation's timer has nothing left to expire.
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, 1, host.Out.Len())
+}
+
+func TestRoomCloseStopsRinging(t *testing.T) {
+	r := &Room{Name: "call", RingTimeout: 20 * time.Millisecond}
+
+	invited, err := r.AddInvited(&InvitedParticipant{Room: r, UserID: 2})
+	require.NoError(t, err)
+	require.True(t, invited)
+
+	// The room is forgotten before anybody answers.
+	r.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	r.Lock.RLock()
+	defer r.Lock.RUnlock()
+	require.Equal(t, InvitePending, r.InvitedParticipants[0].InviteStatus)
+}
@@ -7,4 +7,12 @@ type InvitedParticipant struct {
 	LastName  string  `json:"lastName"`
 	Status    *string `json:"status"`
 	Photo     *string `json:"photo"`
+	// InviteStatus tells whether the invitation is still ringing, see
+	// InvitePending and the other invite statuses.
+	InviteStatus string `json:"inviteStatus"`
+	// ExpiresAt is when a pending or ringing invitation expires, 0 if it
+	// never does.
+	ExpiresAt int64 `json:"expiresAt,omitempty"`
+	// InvitedBy is the user who sent the invitation, 0 if unknown.
+	InvitedBy int64 `json:"invitedBy,omitempty"`
 }
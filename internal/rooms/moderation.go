@@ -0,0 +1,144 @@
+package rooms
+
+import (
+	"context"
+	"encoding/json"
+)
+
+const (
+	MuteParticipantEvent   string = "muteParticipant"
+	DisableCameraEvent     string = "disableCamera"
+	MuteAllEvent           string = "muteAll"
+	RemoveParticipantEvent string = "removeParticipant"
+	LockRoomEvent          string = "lockRoom"
+	UnlockRoomEvent        string = "unlockRoom"
+)
+
+// isForced reports whether the notify event carries a state change made by
+// a moderator, which the instance serving the participant has to apply.
+func isForced(event string) bool {
+	return event == MuteParticipantEvent || event == DisableCameraEvent || event == MuteAllEvent
+}
+
+// Mute turns the participant's microphone off and notifies everyone, the
+// participant included, with the event.
+func (r *Room) Mute(ctx context.Context, p *Participant, event string) {
+	r.Lock.Lock()
+	p.IsMicroOn = false
+	r.Lock.Unlock()
+
+	r.Notify(ctx, p, event)
+}
+
+// DisableCamera turns the participant's camera off and notifies everyone.
+func (r *Room) DisableCamera(ctx context.Context, p *Participant) {
+	r.Lock.Lock()
+	p.CameraType = nil
+	r.Lock.Unlock()
+
+	r.Notify(ctx, p, DisableCameraEvent)
+}
+
+// MuteAll mutes every participant but the moderators.
+func (r *Room) MuteAll(ctx context.Context) {
+	var participants []*Participant
+	func() {
+		r.Lock.RLock()
+		defer r.Lock.RUnlock()
+
+		for _, participant := range r.Participants {
+			if participant.IsMicroOn && !participant.IsModerator() {
+				participants = append(participants, participant)
+			}
+		}
+	}()
+
+	for _, participant := range participants {
+		r.Mute(ctx, participant, MuteAllEvent)
+	}
+}
+
+// RemoveParticipant tells the participant it was removed by a moderator and
+// makes it leave, wherever it is connected. Its connection stays open.
+func (r *Room) RemoveParticipant(ctx context.Context, userID int64, by int64) bool {
+	p, err := r.Get(userID)
+	if err != nil {
+		return false
+	}
+
+	if !p.IsRemote() {
+		r.removeParticipant(p, by)
+		return true
+	}
+
+	r.publish(ctx, Event{
+		Kind:        RemoveKind,
+		Event:       RemoveParticipantEvent,
+		UserID:      userID,
+		ModeratorID: by,
+	})
+
+	return true
+}
+
+func (r *Room) removeParticipant(p *Participant, by int64) {
+	r.sendModeration([]*Participant{p}, RemoveParticipantEvent, p.UserID, by)
+	p.Leave()
+}
+
+// SetLocked locks the room against new participants, or unlocks it.
+func (r *Room) SetLocked(ctx context.Context, locked bool, by int64) {
+	event := r.setLocked(locked, by)
+
+	r.publish(ctx, Event{
+		Kind:        LockKind,
+		Event:       event,
+		ModeratorID: by,
+	})
+}
+
+func (r *Room) setLocked(locked bool, by int64) string {
+	var participants []*Participant
+	func() {
+		r.Lock.Lock()
+		defer r.Lock.Unlock()
+		r.Locked = locked
+		participants = append(participants, r.Participants...)
+	}()
+
+	event := UnlockRoomEvent
+	if locked {
+		event = LockRoomEvent
+	}
+
+	r.sendModeration(participants, event, 0, by)
+
+	return event
+}
+
+func (r *Room) IsLocked() bool {
+	r.Lock.RLock()
+	defer r.Lock.RUnlock()
+
+	return r.Locked
+}
+
+func (r *Room) sendModeration(participants []*Participant, event string, userID int64, by int64) {
+	response := NotifyModerationResponse{
+		NotifyModerationMessage{
+			Action:      "notify",
+			Event:       event,
+			UserID:      userID,
+			ModeratorID: by,
+		},
+	}
+
+	message, err := json.Marshal(response)
+	if err != nil {
+		return
+	}
+
+	for _, participant := range participants {
+		participant.Send(message)
+	}
+}
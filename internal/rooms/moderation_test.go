@@ -0,0 +1,54 @@
+package rooms
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoomModeration(t *testing.T) {
+	ctx := context.Background()
+	r := &Room{Name: "call", Type: GroupType}
+
+	host := &Participant{Room: r, Out: NewQueue(QueueConfig{}, nil), UserID: 1, IsMicroOn: true}
+	member := &Participant{Room: r, Out: NewQueue(QueueConfig{}, nil), UserID: 2, IsMicroOn: true}
+	require.NoError(t, r.Add(host))
+	require.NoError(t, r.Add(member))
+	require.True(t, host.IsModerator())
+	require.False(t, member.IsModerator())
+
+	r.MuteAll(ctx)
+	require.False(t, member.IsMicroOn)
+	require.True(t, host.IsMicroOn)
+
+	for _, p := range []*Participant{host, member} {
+		response := NotifyResponse{}
+		require.NoError(t, json.Unmarshal(receive(t, p.Out), &response))
+		require.Equal(t, MuteAllEvent, response.Message.Event)
+		require.Equal(t, member.UserID, response.Message.Peer.UserID)
+		require.False(t, response.Message.Peer.IsMicroOn)
+	}
+
+	r.SetLocked(ctx, true, host.UserID)
+	require.True(t, r.IsLocked())
+	response := NotifyModerationResponse{}
+	require.NoError(t, json.Unmarshal(receive(t, member.Out), &response))
+	require.Equal(t, LockRoomEvent, response.Message.Event)
+	require.Equal(t, host.UserID, response.Message.ModeratorID)
+
+	require.ErrorIs(t, r.Add(&Participant{Room: r, UserID: 3}), ErrRoomLocked)
+	require.NoError(t, r.Add(&Participant{Room: r, UserID: 4, Role: ModeratorRole}))
+
+	left := false
+	member.Cancel = func() { left = true }
+	require.True(t, r.RemoveParticipant(ctx, member.UserID, host.UserID))
+	require.True(t, left)
+	require.False(t, r.RemoveParticipant(ctx, 5, host.UserID))
+
+	response = NotifyModerationResponse{}
+	require.NoError(t, json.Unmarshal(receive(t, member.Out), &response))
+	require.Equal(t, RemoveParticipantEvent, response.Message.Event)
+	require.Equal(t, member.UserID, response.Message.UserID)
+}
@@ -2,42 +2,269 @@ package rooms
 
 import (
 	"context"
+	"crypto/subtle"
 	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	ReconnectingEvent string = "reconnecting"
+	ResumeEvent       string = "resume"
+
+	// maxMissedMessages bounds the notifications kept for a reconnecting participant.
+	maxMissedMessages = 100
+)
+
+const (
+	// HostRole is given to the participant who created the room.
+	HostRole      string = "host"
+	ModeratorRole string = "moderator"
+	MemberRole    string = "member"
+	// ViewerRole participants watch the call without publishing.
+	ViewerRole string = "viewer"
+)
+
+type participantState int
+
+const (
+	connectedState participantState = iota
+	reconnectingState
+	leftState
 )
 
 type Participant struct {
-	Room         *Room       `json:"-"`
-	Out          chan []byte `json:"-"`
-	UserID       int64       `json:"userId"`
-	FirstName    string      `json:"firstName"`
-	LastName     string      `json:"lastName"`
-	Status       *string     `json:"status"`
-	Sex          *int64      `json:"sex"`
-	Photo        *string     `json:"photo"`
-	Publishing   bool        `json:"publishing"`
-	IsHorizontal bool        `json:"isHorizontal"`
-	IsMicroOn    bool        `json:"isMicroOn"`
-	IsSpeakerOn  bool        `json:"isSpeakerOn"`
-	CameraType   *string     `json:"cameraType"`
-	BatteryLife  float64     `json:"batteryLife"`
-	IsReady      bool        `json:"isReady"`
+	Room         *Room              `json:"-"`
+	Out          *Queue             `json:"-"`
+	Cancel       context.CancelFunc `json:"-"`
+	Disconnect   context.CancelFunc `json:"-"`
+	ResumeToken  string             `json:"-"`
+	UserID       int64              `json:"userId"`
+	Role         string             `json:"role"`
+	FirstName    string             `json:"firstName"`
+	LastName     string             `json:"lastName"`
+	Status       *string            `json:"status"`
+	Sex          *int64             `json:"sex"`
+	Photo        *string            `json:"photo"`
+	Streams      map[string]Stream  `json:"streams"`
+	IsHorizontal bool               `json:"isHorizontal"`
+	IsMicroOn    bool               `json:"isMicroOn"`
+	IsSpeakerOn  bool               `json:"isSpeakerOn"`
+	CameraType   *string            `json:"cameraType"`
+	BatteryLife  float64            `json:"batteryLife"`
+	IsReady      bool               `json:"isReady"`
+	Reconnecting bool               `json:"reconnecting"`
+
+	mu     sync.Mutex
+	state  participantState
+	wake   chan struct{}
+	missed [][]byte
+
+	// sessions are the media server sessions of the streams negotiated by
+	// this instance, by kind. They are guarded by the room lock.
+	sessions map[string]StreamSession
 }
 
 func (p *Participant) String() string {
 	return fmt.Sprintf("userID=%v, room=%v", p.UserID, p.Room.Name)
 }
 
+// IsModerator reports whether the participant may moderate the room.
+func (p *Participant) IsModerator() bool {
+	return p.Role == HostRole || p.Role == ModeratorRole
+}
+
+// IsRemote reports whether the participant is a mirror of a connection
+// served by another instance.
+func (p *Participant) IsRemote() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.Out == nil
+}
+
+func (p *Participant) copyState(from *Participant) {
+	p.Role = from.Role
+	p.FirstName = from.FirstName
+	p.LastName = from.LastName
+	p.Status = from.Status
+	p.Sex = from.Sex
+	p.Photo = from.Photo
+	p.Streams = from.Streams
+	p.IsHorizontal = from.IsHorizontal
+	p.IsMicroOn = from.IsMicroOn
+	p.IsSpeakerOn = from.IsSpeakerOn
+	p.CameraType = from.CameraType
+	p.BatteryLife = from.BatteryLife
+	p.IsReady = from.IsReady
+	p.Reconnecting = from.Reconnecting
+}
+
+// Send queues a message for the participant's connection. Messages for a
+// reconnecting participant, or that did not fit in the queue of an evicted
+// connection, are kept until it resumes.
+func (p *Participant) Send(message []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch {
+	case p.state == reconnectingState:
+		p.keep(message)
+	case p.Out == nil:
+	case !p.Out.Push(message):
+		p.keep(message)
+	}
+}
+
+// SendLatest queues a message superseding the queued one with the same
+// key. It is not kept for a reconnecting participant.
+func (p *Participant) SendLatest(key string, message []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.state == reconnectingState || p.Out == nil {
+		return
+	}
+
+	p.Out.PushLatest(key, message)
+}
+
+func (p *Participant) keep(message []byte) {
+	if len(p.missed) == maxMissedMessages {
+		p.missed = p.missed[1:]
+	}
+	p.missed = append(p.missed, message)
+}
+
+// Leave removes the participant from the room without waiting for its
+// connection to close.
+func (p *Participant) Leave() {
+	p.leave(false)
+}
+
+// Kick closes the participant's connection, peers are notified with leave.
+func (p *Participant) Kick() {
+	p.leave(true)
+}
+
+func (p *Participant) leave(disconnect bool) {
+	p.mu.Lock()
+	if p.state == reconnectingState {
+		close(p.wake)
+	}
+	p.state = leftState
+	cancel := p.Cancel
+	if disconnect && p.Disconnect != nil {
+		cancel = p.Disconnect
+	}
+	p.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// Resume attaches a new connection to a reconnecting participant and
+// returns the notifications it missed.
+func (p *Participant) Resume(
+	token string,
+	out *Queue,
+	cancel context.CancelFunc,
+	disconnect context.CancelFunc,
+) ([][]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.state != reconnectingState {
+		return nil, fmt.Errorf("%w: %v is not reconnecting", ErrResumeFailed, p.UserID)
+	}
+
+	if p.ResumeToken == "" || subtle.ConstantTimeCompare([]byte(p.ResumeToken), []byte(token)) != 1 {
+		return nil, fmt.Errorf("%w: invalid resume token for %v", ErrResumeFailed, p.UserID)
+	}
+
+	missed := p.missed
+
+	p.Out = out
+	p.Cancel = cancel
+	p.Disconnect = disconnect
+	p.Reconnecting = false
+	p.state = connectedState
+	p.missed = nil
+	close(p.wake)
+
+	return missed, nil
+}
+
+// suspend marks the participant as reconnecting unless it left on purpose.
+func (p *Participant) suspend() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.state == leftState {
+		return false
+	}
+
+	p.state = reconnectingState
+	p.Reconnecting = true
+	p.wake = make(chan struct{})
+
+	return true
+}
+
+// expire reports whether the participant has to be removed after the
+// grace period, i.e. it did not resume.
+func (p *Participant) expire() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.state == connectedState {
+		return false
+	}
+
+	p.state = leftState
+	p.Reconnecting = false
+	p.missed = nil
+
+	return true
+}
+
 // HandleContextDone Todo: возможно есть лучше варианты, как удалить комнату если из нее вышли все участники?
-func (p *Participant) HandleContextDone(ctx context.Context, emptyRooms chan<- string) {
+// A participant whose connection dropped is kept for the grace period so
+// it can resume the call.
+func (p *Participant) HandleContextDone(ctx context.Context, emptyRooms chan<- string, grace time.Duration) {
 	<-ctx.Done()
 	if p == nil {
 		return
 	}
 
-	p.Room.Remove(p)
-	p.Room.Notify(context.Background(), p, "leave")
+	if grace > 0 && p.suspend() {
+		p.Room.Notify(context.Background(), p, ReconnectingEvent)
+
+		p.mu.Lock()
+		wake := p.wake
+		p.mu.Unlock()
+
+		timer := time.NewTimer(grace)
+		select {
+		case <-wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+
+		if !p.expire() {
+			return
+		}
+	}
+
+	// Viewers stop playing the streams before the participant is gone.
+	p.Room.UnpublishAll(context.Background(), p)
+
+	if p.Room.Remove(p) {
+		p.Room.Notify(context.Background(), p, "leave")
+	}
 
-	if len(p.Room.Participants) == 0 {
+	if p.Room.IsEmpty() {
 		emptyRooms <- p.Room.Name
 	}
 }
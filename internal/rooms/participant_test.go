@@ -0,0 +1,82 @@
+package rooms
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParticipantResume(t *testing.T) {
+	r := &Room{Name: "call"}
+
+	alice := &Participant{Room: r, Out: NewQueue(QueueConfig{}, nil), UserID: 1}
+	require.NoError(t, r.Add(alice))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	bob := &Participant{Room: r, Out: NewQueue(QueueConfig{}, nil), Cancel: cancel, UserID: 2, ResumeToken: "token"}
+	require.NoError(t, r.Add(bob))
+
+	emptyRooms := make(chan string, 1)
+	go bob.HandleContextDone(ctx, emptyRooms, time.Minute)
+
+	cancel()
+
+	response := NotifyResponse{}
+	require.NoError(t, json.Unmarshal(receive(t, alice.Out), &response))
+	require.Equal(t, ReconnectingEvent, response.Message.Event)
+	require.True(t, response.Message.Peer.Reconnecting)
+
+	r.Notify(context.Background(), alice, "changeState")
+	receive(t, alice.Out)
+
+	_, err := bob.Resume("other", NewQueue(QueueConfig{}, nil), func() {}, func() {})
+	require.ErrorIs(t, err, ErrResumeFailed)
+
+	missed, err := bob.Resume("token", NewQueue(QueueConfig{}, nil), func() {}, func() {})
+	require.NoError(t, err)
+	require.NotEmpty(t, missed)
+	require.False(t, bob.Reconnecting)
+
+	_, err = r.Get(bob.UserID)
+	require.NoError(t, err)
+
+	_, err = bob.Resume("token", NewQueue(QueueConfig{}, nil), func() {}, func() {})
+	require.ErrorIs(t, err, ErrResumeFailed)
+}
+
+func TestParticipantResumeExpired(t *testing.T) {
+	r := &Room{Name: "call"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	bob := &Participant{Room: r, Out: NewQueue(QueueConfig{}, nil), Cancel: cancel, UserID: 2, ResumeToken: "token"}
+	require.NoError(t, r.Add(bob))
+
+	emptyRooms := make(chan string, 1)
+	go bob.HandleContextDone(ctx, emptyRooms, 10*time.Millisecond)
+
+	cancel()
+
+	require.Equal(t, "call", <-emptyRooms)
+
+	_, err := bob.Resume("token", NewQueue(QueueConfig{}, nil), func() {}, func() {})
+	require.ErrorIs(t, err, ErrResumeFailed)
+}
+
+func TestParticipantSendEvicted(t *testing.T) {
+	r := &Room{Name: "call"}
+
+	evicted := false
+	alice := &Participant{Room: r, Out: NewQueue(QueueConfig{Size: 1}, func() { evicted = true }), UserID: 1}
+	require.NoError(t, r.Add(alice))
+
+	alice.Send([]byte("join"))
+	alice.Send([]byte("ready"))
+	require.False(t, evicted)
+	alice.Send([]byte("changeState"))
+	require.True(t, evicted)
+
+	require.Equal(t, [][]byte{[]byte("changeState")}, alice.missed)
+}
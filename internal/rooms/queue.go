@@ -0,0 +1,189 @@
+package rooms
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DropFull is reported when a message is dropped because the queue is full.
+	DropFull string = "full"
+	// DropCoalesced is reported when a queued message is replaced by a newer one.
+	DropCoalesced string = "coalesced"
+)
+
+type QueueConfig struct {
+	// Size bounds the number of queued messages.
+	Size int
+	// EvictAfter is how long the queue may stay full before the connection
+	// is evicted. Messages that must be delivered are queued over Size
+	// meanwhile, up to twice Size.
+	EvictAfter time.Duration
+	// OnDrop is told about every message that is not delivered.
+	OnDrop func(reason string)
+}
+
+type queued struct {
+	key     string
+	message []byte
+}
+
+// Queue is the bounded outbound queue of a connection. Pushing never
+// blocks, so a slow client can not hold up the room notifications: its
+// droppable messages are dropped and it is evicted when it can not keep up.
+type Queue struct {
+	config QueueConfig
+	evict  func()
+	ready  chan struct{}
+
+	mu        sync.Mutex
+	items     []queued
+	fullSince time.Time
+	evicted   bool
+}
+
+func NewQueue(config QueueConfig, evict func()) *Queue {
+	if config.Size <= 0 {
+		config.Size = 256
+	}
+	if config.EvictAfter <= 0 {
+		config.EvictAfter = 10 * time.Second
+	}
+
+	return &Queue{
+		config: config,
+		evict:  evict,
+		ready:  make(chan struct{}, 1),
+	}
+}
+
+// Push queues a message that must be delivered, over Size while the client
+// may still catch up. The connection is evicted if the queue stays full for
+// EvictAfter or reaches twice Size, Push then returns false.
+func (q *Queue) Push(message []byte) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.evicted {
+		return false
+	}
+
+	if len(q.items) >= q.config.Size && (q.full() || len(q.items) >= 2*q.config.Size) {
+		q.drop(DropFull)
+		q.evictLocked()
+		return false
+	}
+
+	q.push(queued{message: message})
+
+	return true
+}
+
+// PushLatest queues a message that supersedes the queued message with the
+// same key. It is dropped when the queue is full, the connection is evicted
+// if the queue stays full for EvictAfter.
+func (q *Queue) PushLatest(key string, message []byte) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.evicted {
+		return false
+	}
+
+	for i := range q.items {
+		if q.items[i].key == key {
+			q.items[i].message = message
+			q.drop(DropCoalesced)
+			return true
+		}
+	}
+
+	if len(q.items) >= q.config.Size {
+		q.drop(DropFull)
+		if q.full() {
+			q.evictLocked()
+		}
+		return false
+	}
+
+	q.push(queued{key: key, message: message})
+
+	return true
+}
+
+// Ready is signalled when messages are queued.
+func (q *Queue) Ready() <-chan struct{} {
+	return q.ready
+}
+
+// Pop returns the oldest queued message.
+func (q *Queue) Pop() ([]byte, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) == 0 {
+		return nil, false
+	}
+
+	item := q.items[0]
+	q.items[0] = queued{}
+	q.items = q.items[1:]
+	if len(q.items) < q.config.Size {
+		q.fullSince = time.Time{}
+	}
+
+	return item.message, true
+}
+
+// Evicted reports whether the connection could not keep up.
+func (q *Queue) Evicted() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.evicted
+}
+
+// Len returns the number of queued messages.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.items)
+}
+
+func (q *Queue) push(item queued) {
+	q.items = append(q.items, item)
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// full records that the queue is full, it reports whether it stayed full
+// for EvictAfter.
+func (q *Queue) full() bool {
+	if q.fullSince.IsZero() {
+		q.fullSince = time.Now()
+		return false
+	}
+
+	return time.Since(q.fullSince) >= q.config.EvictAfter
+}
+
+func (q *Queue) drop(reason string) {
+	if q.config.OnDrop != nil {
+		q.config.OnDrop(reason)
+	}
+}
+
+func (q *Queue) evictLocked() {
+	if q.evicted {
+		return
+	}
+	q.evicted = true
+
+	if q.evict != nil {
+		q.evict()
+	}
+}
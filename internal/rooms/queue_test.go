@@ -0,0 +1,91 @@
+package rooms
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueue(t *testing.T) {
+	var drops []string
+	evicted := 0
+
+	q := NewQueue(QueueConfig{
+		Size:       2,
+		EvictAfter: time.Hour,
+		OnDrop: func(reason string) {
+			drops = append(drops, reason)
+		},
+	}, func() {
+		evicted++
+	})
+
+	require.True(t, q.PushLatest("speak:1", []byte("1")))
+	require.True(t, q.PushLatest("speak:1", []byte("2")))
+	require.True(t, q.Push([]byte("join")))
+	require.False(t, q.PushLatest("speak:2", []byte("3")))
+	require.Equal(t, []string{DropCoalesced, DropFull}, drops)
+	require.Zero(t, evicted)
+
+	require.Equal(t, []byte("2"), receive(t, q))
+	require.True(t, q.Push([]byte("leave")))
+
+	// Messages that must be delivered go over the bound for a while, but
+	// not past twice of it.
+	require.True(t, q.Push([]byte("changeState")))
+	require.True(t, q.Push([]byte("ready")))
+	require.Zero(t, evicted)
+	require.False(t, q.Push([]byte("changeState")))
+	require.Equal(t, 1, evicted)
+	require.False(t, q.Push([]byte("changeState")))
+	require.Equal(t, 1, evicted)
+
+	require.Equal(t, []byte("join"), receive(t, q))
+	require.Equal(t, []byte("leave"), receive(t, q))
+	require.Equal(t, []byte("changeState"), receive(t, q))
+	require.Equal(t, []byte("ready"), receive(t, q))
+}
+
+func TestQueueEvictsWhenFull(t *testing.T) {
+	evicted := false
+	q := NewQueue(QueueConfig{Size: 1, EvictAfter: time.Millisecond}, func() {
+		evicted = true
+	})
+
+	require.True(t, q.Push([]byte("join")))
+	require.False(t, q.PushLatest("speak:1", []byte("1")))
+	time.Sleep(2 * time.Millisecond)
+	require.False(t, q.PushLatest("speak:1", []byte("2")))
+	require.True(t, evicted)
+
+	// A client that does not catch up with the messages that must be
+	// delivered is evicted as well.
+	evicted = false
+	q = NewQueue(QueueConfig{Size: 1, EvictAfter: time.Millisecond}, func() {
+		evicted = true
+	})
+
+	require.True(t, q.Push([]byte("join")))
+	require.True(t, q.Push([]byte("ready")))
+	require.False(t, evicted)
+	time.Sleep(2 * time.Millisecond)
+	require.False(t, q.Push([]byte("leave")))
+	require.True(t, evicted)
+}
+
+func receive(t *testing.T, q *Queue) []byte {
+	t.Helper()
+
+	for {
+		if m, ok := q.Pop(); ok {
+			return m
+		}
+
+		select {
+		case <-q.Ready():
+		case <-time.After(time.Second):
+			t.Fatal("message was not delivered")
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package rooms
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter allows every user limit actions per sliding window.
+type rateLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu   sync.Mutex
+	sent map[int64][]time.Time
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{
+		limit:  limit,
+		window: window,
+		sent:   map[int64][]time.Time{},
+	}
+}
+
+// allow records the action of the user unless it went over the limit.
+func (l *rateLimiter) allow(userID int64, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sent := l.sent[userID]
+	for len(sent) > 0 && now.Sub(sent[0]) >= l.window {
+		sent = sent[1:]
+	}
+
+	if len(sent) >= l.limit {
+		l.sent[userID] = sent
+		return false
+	}
+
+	l.sent[userID] = append(sent, now)
+
+	return true
+}
@@ -1,5 +1,17 @@
 package rooms
 
+import "encoding/json"
+
+const (
+	CallStartedEvent string = "callStarted"
+	CallEndedEvent   string = "callEnded"
+
+	HangupReason string = "hangup"
+	ClosedReason string = "closed"
+	// EmptyReason ends a call when its last participant leaves.
+	EmptyReason string = "empty"
+)
+
 type NotifyResponse struct {
 	Message NotifyMessage `json:"msg"`
 }
@@ -12,6 +24,8 @@ type NotifyMessage struct {
 	Participants        []*Participant        `json:"participants"`
 	InvitedParticipants []*InvitedParticipant `json:"invitedParticipants"`
 	StartedAt           *int64                `json:"startedAt"`
+	Hands               []RaisedHand          `json:"hands"`
+	Stream              string                `json:"stream,omitempty"`
 }
 
 type NotifyPreconnectResponse struct {
@@ -25,13 +39,116 @@ type NotifyPreconnectMessage struct {
 	DeviceID string `json:"deviceId"`
 }
 
-type NotifySpeakResponse struct {
-	Message NotifySpeakMessage `json:"msg"`
+type NotifyActiveSpeakerResponse struct {
+	Message NotifyActiveSpeakerMessage `json:"msg"`
 }
 
-type NotifySpeakMessage struct {
+type NotifyActiveSpeakerMessage struct {
 	Action string  `json:"action"`
 	Event  string  `json:"event"`
 	UserID int64   `json:"userId"`
 	Level  float64 `json:"level"`
 }
+
+type NotifyLevelsResponse struct {
+	Message NotifyLevelsMessage `json:"msg"`
+}
+
+type NotifyLevelsMessage struct {
+	Action string         `json:"action"`
+	Event  string         `json:"event"`
+	Levels []SpeakerLevel `json:"levels"`
+}
+
+type NotifyRelayResponse struct {
+	Message NotifyRelayMessage `json:"msg"`
+}
+
+type NotifyRelayMessage struct {
+	Action    string          `json:"action"`
+	Event     string          `json:"event"`
+	UserID    int64           `json:"userId"`
+	SDP       string          `json:"sdp,omitempty"`
+	Candidate json.RawMessage `json:"candidate,omitempty"`
+}
+
+type NotifyModerationResponse struct {
+	Message NotifyModerationMessage `json:"msg"`
+}
+
+type NotifyModerationMessage struct {
+	Action      string `json:"action"`
+	Event       string `json:"event"`
+	UserID      int64  `json:"userId,omitempty"`
+	ModeratorID int64  `json:"moderatorId"`
+}
+
+type NotifyCallEndedResponse struct {
+	Message NotifyCallEndedMessage `json:"msg"`
+}
+
+type NotifyCallEndedMessage struct {
+	Action    string `json:"action"`
+	Event     string `json:"event"`
+	UserID    int64  `json:"userId"`
+	Reason    string `json:"reason"`
+	StartedAt *int64 `json:"startedAt"`
+	Duration  int64  `json:"duration"`
+}
+
+type NotifyInviteResponse struct {
+	Message NotifyInviteMessage `json:"msg"`
+}
+
+type NotifyInviteMessage struct {
+	Action              string                `json:"action"`
+	Event               string                `json:"event"`
+	UserID              int64                 `json:"userId"`
+	By                  int64                 `json:"by,omitempty"`
+	InvitedParticipants []*InvitedParticipant `json:"invitedParticipants"`
+}
+
+type NotifyChatResponse struct {
+	Message NotifyChatMessage `json:"msg"`
+}
+
+type NotifyChatMessage struct {
+	Action string       `json:"action"`
+	Event  string       `json:"event"`
+	Chat   *ChatMessage `json:"chat"`
+}
+
+type NotifyChatAckResponse struct {
+	Message NotifyChatAckMessage `json:"msg"`
+}
+
+type NotifyChatAckMessage struct {
+	Action    string `json:"action"`
+	Event     string `json:"event"`
+	MessageID string `json:"messageId"`
+	UserID    int64  `json:"userId"`
+	Status    string `json:"status"`
+}
+
+type NotifyCustomResponse struct {
+	Message NotifyCustomMessage `json:"msg"`
+}
+
+type NotifyCustomMessage struct {
+	Action  string          `json:"action"`
+	Event   string          `json:"event"`
+	Type    string          `json:"type"`
+	UserID  int64           `json:"userId"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+type NotifyReactionResponse struct {
+	Message NotifyReactionMessage `json:"msg"`
+}
+
+type NotifyReactionMessage struct {
+	Action   string `json:"action"`
+	Event    string `json:"event"`
+	UserID   int64  `json:"userId"`
+	Reaction string `json:"reaction"`
+}
@@ -3,6 +3,7 @@ package rooms
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -10,14 +11,79 @@ import (
 	"github.com/ossrs/go-oryx-lib/logger"
 )
 
+const (
+	// SFUMode rooms stream through the media server.
+	SFUMode string = "sfu"
+	// P2PMode rooms relay offers, answers and ICE candidates between the
+	// participants.
+	P2PMode string = "p2p"
+
+	// DirectType rooms are 1:1 calls.
+	DirectType string = "direct"
+	// GroupType rooms take up to MaxParticipants.
+	GroupType string = "group"
+)
+
+var (
+	ErrParticipantExists   = errors.New("participant exists")
+	ErrParticipantNotFound = errors.New("participant does not exist")
+	ErrDeviceExists        = errors.New("device exists")
+	ErrDeviceNotFound      = errors.New("device not found")
+	ErrResumeFailed        = errors.New("resume failed")
+	ErrRoomFull            = errors.New("room is full")
+	ErrRoomLocked          = errors.New("room is locked")
+	ErrNotInviter          = errors.New("not the inviter")
+)
+
 type Room struct {
 	Name                string                `json:"-"`
 	Token               string                `json:"-"`
-	Devices             []*Device             `json:"-"`
+	DeviceGroups        []*DeviceGroup        `json:"-"`
 	Participants        []*Participant        `json:"participants"`
 	InvitedParticipants []*InvitedParticipant `json:"invitedParticipants"`
 	StartedAt           *int64                `json:"startedAt"`
+	InitiatorID         int64                 `json:"initiatorId"`
+	EndedAt             *int64                `json:"-"`
+	Type                string                `json:"-"`
+	MaxParticipants     int                   `json:"-"`
+	MaxScreenShares     int                   `json:"-"`
+	RingTimeout         time.Duration         `json:"-"`
+	Locked              bool                  `json:"-"`
+	MediaServer         string                `json:"-"`
+	Mode                string                `json:"-"`
+	SpeakerConfig       SpeakerConfig         `json:"-"`
+	ChatConfig          ChatConfig            `json:"-"`
+	ReactionConfig      ReactionConfig        `json:"-"`
+	RaisedHands         []RaisedHand          `json:"-"`
+	Broker              Broker                `json:"-"`
+	Observer            Observer              `json:"-"`
 	Lock                sync.RWMutex          `json:"-"`
+
+	speakers  *speakers
+	chatState *chat
+	reactions *rateLimiter
+	// ringTimers expire the invitations by user, they are stopped when the
+	// room is closed.
+	ringTimers map[int64]*time.Timer
+	closed     bool
+}
+
+// Snapshot is a copy of the room state that is safe to read without the lock.
+type Snapshot struct {
+	Name                string                `json:"name"`
+	Type                string                `json:"type"`
+	MaxParticipants     int                   `json:"maxParticipants"`
+	Locked              bool                  `json:"locked"`
+	StartedAt           *int64                `json:"startedAt"`
+	EndedAt             *int64                `json:"endedAt"`
+	InitiatorID         int64                 `json:"initiatorId"`
+	Participants        []*Participant        `json:"participants"`
+	InvitedParticipants []*InvitedParticipant `json:"invitedParticipants"`
+	Devices             []*Device             `json:"devices"`
+	MediaServer         string                `json:"mediaServer,omitempty"`
+	Mode                string                `json:"mode,omitempty"`
+	ActiveSpeaker       int64                 `json:"activeSpeaker,omitempty"`
+	Hands               []RaisedHand          `json:"hands"`
 }
 
 type State struct {
@@ -32,158 +98,351 @@ func (r *Room) String() string {
 }
 
 func (r *Room) Add(p *Participant) error {
+	startedAt, err := r.add(p)
+	if err != nil {
+		return err
+	}
+
+	if startedAt != nil {
+		r.observe(context.Background(), Event{
+			Kind:      StartKind,
+			Event:     CallStartedEvent,
+			UserID:    p.UserID,
+			StartedAt: startedAt,
+		})
+	}
+
+	return nil
+}
+
+// add returns the start time if the participant started the call. The
+// call starts when the second participant joins, whatever the room type.
+func (r *Room) add(p *Participant) (*int64, error) {
 	r.Lock.Lock()
 	defer r.Lock.Unlock()
 
-	for i, participant := range r.InvitedParticipants {
+	for _, participant := range r.Participants {
 		if participant.UserID == p.UserID {
-			r.InvitedParticipants = append(r.InvitedParticipants[:i], r.InvitedParticipants[i+1:]...)
-			break
+			return nil, fmt.Errorf("%w: %v in room %v", ErrParticipantExists, p.UserID, r.Name)
 		}
 	}
 
-	for _, participant := range r.Participants {
+	if r.MaxParticipants > 0 && len(r.Participants) >= r.MaxParticipants {
+		return nil, fmt.Errorf("%w: %v has %d participants", ErrRoomFull, r.Name, len(r.Participants))
+	}
+
+	if r.Locked && !p.IsModerator() {
+		return nil, fmt.Errorf("%w: %v", ErrRoomLocked, r.Name)
+	}
+
+	for i, participant := range r.InvitedParticipants {
 		if participant.UserID == p.UserID {
-			return fmt.Errorf("participant %v exists in room %v", p.UserID, r.Name)
+			r.InvitedParticipants = append(r.InvitedParticipants[:i], r.InvitedParticipants[i+1:]...)
+			break
 		}
 	}
 
 	r.Participants = append(r.Participants, p)
 
-	if len(r.Participants) == 2 {
+	if len(r.Participants) == 1 && r.InitiatorID == 0 {
+		r.InitiatorID = p.UserID
+	}
+
+	if p.Role == "" {
+		p.Role = MemberRole
+		if p.UserID == r.InitiatorID {
+			p.Role = HostRole
+		}
+	}
+
+	if len(r.Participants) == 2 && r.StartedAt == nil {
 		unixTime := time.Now().Unix()
 		r.StartedAt = &unixTime
+		return r.StartedAt, nil
 	}
 
-	return nil
+	return nil, nil
 }
 
-func (r *Room) AddInvited(p *InvitedParticipant) error {
+// AddInvited invites the user unless it is in the room or its invitation
+// is still ringing, it reports whether the invitation was sent. The
+// invitation expires after RingTimeout.
+func (r *Room) AddInvited(p *InvitedParticipant) (bool, error) {
 	r.Lock.Lock()
 	defer r.Lock.Unlock()
 
 	for _, participant := range r.Participants {
 		if participant.UserID == p.UserID {
-			return nil
+			return false, nil
 		}
 	}
 
-	for _, participant := range r.InvitedParticipants {
-		if participant.UserID == p.UserID {
-			return nil
+	p.InviteStatus = InvitePending
+	p.ExpiresAt = 0
+	if r.RingTimeout > 0 {
+		p.ExpiresAt = time.Now().Add(r.RingTimeout).Unix()
+	}
+
+	replaced := false
+	for i, participant := range r.InvitedParticipants {
+		if participant.UserID != p.UserID {
+			continue
 		}
+
+		if participant.isRinging() {
+			return false, nil
+		}
+
+		// Declined, busy and expired invitations are sent again.
+		r.InvitedParticipants[i] = p
+		replaced = true
+		break
 	}
 
-	r.InvitedParticipants = append(r.InvitedParticipants, p)
-	return nil
+	if !replaced {
+		r.InvitedParticipants = append(r.InvitedParticipants, p)
+	}
+
+	if group := r.group(p.UserID); group != nil {
+		group.reset()
+	}
+
+	if r.RingTimeout > 0 && !r.closed {
+		userID, expiresAt := p.UserID, p.ExpiresAt
+		if timer := r.ringTimers[userID]; timer != nil {
+			timer.Stop()
+		}
+		if r.ringTimers == nil {
+			r.ringTimers = map[int64]*time.Timer{}
+		}
+		r.ringTimers[userID] = time.AfterFunc(r.RingTimeout, func() {
+			r.expireInvite(context.Background(), userID, expiresAt)
+		})
+	}
+
+	return true, nil
+}
+
+// Close stops the timers of a room that is forgotten, they must not change
+// it, nor bring its shared state back, anymore.
+func (r *Room) Close() {
+	r.Lock.Lock()
+	defer r.Lock.Unlock()
+
+	r.closed = true
+	for _, timer := range r.ringTimers {
+		timer.Stop()
+	}
+	r.ringTimers = nil
 }
 
 func (r *Room) AddDevice(d *Device) error {
 	r.Lock.Lock()
 	defer r.Lock.Unlock()
 
-	for _, device := range r.Devices {
-		if device.ID == d.ID {
-			return fmt.Errorf("device %v exists in room %v", d.ID, r.Name)
-		}
+	if device, _ := r.device(d.ID); device != nil {
+		return fmt.Errorf("%w: %v in room %v", ErrDeviceExists, d.ID, r.Name)
+	}
+
+	group := r.group(d.UserID)
+	if group == nil {
+		group = &DeviceGroup{UserID: d.UserID}
+		r.DeviceGroups = append(r.DeviceGroups, group)
 	}
+	group.Devices = append(group.Devices, d)
 
-	r.Devices = append(r.Devices, d)
 	return nil
 }
 
+// RemoveDevice removes the device, its group keeps the user's answer.
 func (r *Room) RemoveDevice(d *Device) {
 	r.Lock.Lock()
 	defer r.Lock.Unlock()
 
-	for i, device := range r.Devices {
+	group := r.group(d.UserID)
+	if group == nil {
+		return
+	}
+
+	for i, device := range group.Devices {
 		if device == d {
 			logger.Tf(context.Background(), "Remove device: %v", d)
-			r.Devices = append(r.Devices[:i], r.Devices[i+1:]...)
+			group.Devices = append(group.Devices[:i], group.Devices[i+1:]...)
 			break
 		}
 	}
 }
 
+// GetDeviceHistory returns the device that answered the call for the user
+// on another device, else the device of another user who declined or was
+// busy, nil while nobody answered.
 func (r *Room) GetDeviceHistory(userID int64) (*Device, error) {
-	r.Lock.Lock()
-	defer r.Lock.Unlock()
+	r.Lock.RLock()
+	defer r.Lock.RUnlock()
 
-	for _, device := range r.Devices {
-		if (device.Status == DeclineStatus || device.Status == BusyStatus) && device.UserID != userID {
-			return device, nil
-		}
+	if group := r.group(userID); group != nil && group.decidedBy != nil {
+		return group.decidedBy, nil
 	}
 
-	for _, device := range r.Devices {
-		if device.Status != "" && device.UserID == userID {
-			return device, nil
+	for _, group := range r.DeviceGroups {
+		if group.UserID != userID && (group.State == DeclinedCallState || group.State == BusyCallState) {
+			return group.decidedBy, nil
 		}
 	}
 
 	return nil, nil
 }
 
-func (r *Room) Accept(deviceID string) (*Device, error) {
+func (r *Room) Accept(userID int64, deviceID string) (*Device, error) {
+	return r.answer(userID, deviceID, AcceptStatus)
+}
+
+func (r *Room) Decline(userID int64, deviceID string) (*Device, error) {
+	return r.answer(userID, deviceID, DeclineStatus)
+}
+
+func (r *Room) Busy(userID int64, deviceID string) (*Device, error) {
+	return r.answer(userID, deviceID, BusyStatus)
+}
+
+// answer records the answer of a device of the user, the devices of other
+// users are not found.
+func (r *Room) answer(userID int64, deviceID string, status string) (*Device, error) {
 	r.Lock.Lock()
 	defer r.Lock.Unlock()
 
-	for _, device := range r.Devices {
-		if device.ID == deviceID {
-			device.Status = AcceptStatus
-			return device, nil
-		}
+	device, group := r.device(deviceID)
+	if device == nil || device.UserID != userID {
+		return nil, fmt.Errorf("(%s) %w: %v of %d", status, ErrDeviceNotFound, deviceID, userID)
 	}
 
-	return nil, fmt.Errorf("(accept) device %v not found", deviceID)
+	device.Status = status
+	group.update(device)
+
+	return device, nil
 }
 
-func (r *Room) Decline(deviceID string) (*Device, error) {
-	r.Lock.Lock()
-	defer r.Lock.Unlock()
+func (r *Room) Get(userID int64) (*Participant, error) {
+	r.Lock.RLock()
+	defer r.Lock.RUnlock()
 
-	for _, device := range r.Devices {
-		if device.ID == deviceID {
-			device.Status = DeclineStatus
-			return device, nil
+	for _, participant := range r.Participants {
+		if participant.UserID == userID {
+			return participant, nil
 		}
 	}
 
-	return nil, fmt.Errorf("(decline) device %v not found", deviceID)
+	return nil, fmt.Errorf("%w: %v in room %v", ErrParticipantNotFound, userID, r.Name)
+}
+
+func (r *Room) IsEmpty() bool {
+	r.Lock.RLock()
+	defer r.Lock.RUnlock()
+
+	return len(r.Participants) == 0
+}
+
+func (r *Room) Snapshot() Snapshot {
+	r.Lock.RLock()
+	defer r.Lock.RUnlock()
+
+	snapshot := Snapshot{
+		Name:            r.Name,
+		Type:            r.Type,
+		MaxParticipants: r.MaxParticipants,
+		Locked:          r.Locked,
+		StartedAt:       r.StartedAt,
+		EndedAt:         r.EndedAt,
+		InitiatorID:     r.InitiatorID,
+		MediaServer:     r.MediaServer,
+		Mode:            r.Mode,
+	}
+	if r.speakers != nil {
+		snapshot.ActiveSpeaker = r.speakers.activeSpeaker()
+	}
+	snapshot.Participants = append(snapshot.Participants, r.Participants...)
+	snapshot.InvitedParticipants = append(snapshot.InvitedParticipants, r.InvitedParticipants...)
+	snapshot.Hands = append([]RaisedHand{}, r.RaisedHands...)
+	snapshot.Devices = r.devices()
+
+	return snapshot
+}
+
+// AssignedMediaServer returns the media server node the room streams
+// through, empty until the first stream.
+func (r *Room) AssignedMediaServer() string {
+	r.Lock.RLock()
+	defer r.Lock.RUnlock()
+
+	return r.MediaServer
 }
 
-func (r *Room) Busy(deviceID string) (*Device, error) {
+// AssignMediaServer moves the room to node if it is still assigned to
+// current and returns the node the room ends up assigned to.
+func (r *Room) AssignMediaServer(ctx context.Context, current string, node string) string {
 	r.Lock.Lock()
-	defer r.Lock.Unlock()
+	if r.MediaServer != current {
+		actual := r.MediaServer
+		r.Lock.Unlock()
+		return actual
+	}
+	r.MediaServer = node
+	r.Lock.Unlock()
 
-	for _, device := range r.Devices {
-		if device.ID == deviceID {
-			device.Status = BusyStatus
-			return device, nil
-		}
+	r.publish(ctx, Event{
+		Kind:        MediaServerKind,
+		MediaServer: node,
+	})
+
+	return node
+}
+
+// Kick disconnects the participant wherever it is connected. It reports
+// whether the participant was in the room.
+func (r *Room) Kick(ctx context.Context, userID int64) bool {
+	p, err := r.Get(userID)
+	if err != nil {
+		return false
+	}
+
+	if !p.IsRemote() {
+		p.Kick()
+		return true
 	}
 
-	return nil, fmt.Errorf("(busy) device %v not found", deviceID)
+	r.publish(ctx, Event{
+		Kind:   KickKind,
+		UserID: userID,
+	})
+
+	return true
 }
 
-func (r *Room) Get(userID int64) (*Participant, error) {
+// Stats counts the participants and devices connected to this instance.
+func (r *Room) Stats() (participants int, devices int) {
 	r.Lock.RLock()
 	defer r.Lock.RUnlock()
 
 	for _, participant := range r.Participants {
-		if participant.UserID == userID {
-			return participant, nil
+		if !participant.IsRemote() {
+			participants++
 		}
 	}
 
-	return nil, fmt.Errorf("participant %v does not exist in room %v", userID, r.Name)
+	for _, device := range r.devices() {
+		if device.Out != nil {
+			devices++
+		}
+	}
+
+	return participants, devices
 }
 
-func (r *Room) ChangePublishing(p *Participant, publishing bool) {
-	r.Lock.Lock()
-	defer r.Lock.Unlock()
+func (r *Room) IsInitiator(userID int64) bool {
+	r.Lock.RLock()
+	defer r.Lock.RUnlock()
 
-	p.Publishing = publishing
+	return r.InitiatorID == userID
 }
 
 func (r *Room) Ready(p *Participant) {
@@ -203,36 +462,70 @@ func (r *Room) ChangeState(p *Participant, state State) {
 	p.BatteryLife = state.BatteryLife
 }
 
-func (r *Room) Remove(p *Participant) {
+// Remove reports whether the participant was still in the room.
+func (r *Room) Remove(p *Participant) bool {
 	r.Lock.Lock()
 	defer r.Lock.Unlock()
 
 	for i, participant := range r.Participants {
 		if p == participant {
 			r.Participants = append(r.Participants[:i], r.Participants[i+1:]...)
-			break
+			r.lowerHand(p.UserID)
+			return true
 		}
 	}
+
+	return false
 }
 
 func (r *Room) NotifyPreconnect(ctx context.Context, d *Device, event string) {
+	r.notifyPreconnect(ctx, d, event)
+
+	r.publish(ctx, Event{
+		Kind:   PreconnectKind,
+		Event:  event,
+		Device: d,
+	})
+
+	r.UpdateInvite(ctx, d)
+}
+
+func (r *Room) notifyPreconnect(ctx context.Context, d *Device, event string) {
 	var devices []*Device
+	var state string
 	func() {
 		r.Lock.RLock()
 		defer r.Lock.RUnlock()
 
-		devices = append(devices, r.Devices...)
+		devices = r.devices()
+		if group := r.group(d.UserID); group != nil {
+			state = group.State
+		}
 	}()
 
+	// The user's other devices stop ringing once one of them answered.
+	siblingEvent := event
+	switch {
+	case event == AcceptStatus && state == AcceptedCallState:
+		siblingEvent = AnsweredElsewhereEvent
+	case event == DeclineStatus && state == DeclinedCallState:
+		siblingEvent = DeclinedElsewhereEvent
+	}
+
 	for _, device := range devices {
-		if device == d {
+		if device == d || device.Out == nil {
 			continue
 		}
 
+		deviceEvent := event
+		if device.UserID == d.UserID {
+			deviceEvent = siblingEvent
+		}
+
 		response := NotifyPreconnectResponse{
 			NotifyPreconnectMessage{
 				Action:   "notify",
-				Event:    event,
+				Event:    deviceEvent,
 				UserID:   d.UserID,
 				DeviceID: d.ID,
 			},
@@ -243,22 +536,56 @@ func (r *Room) NotifyPreconnect(ctx context.Context, d *Device, event string) {
 			return
 		}
 
-		select {
-		case <-ctx.Done():
-			return
-		case device.Out <- message:
-		}
+		device.Send(message)
 	}
 }
 
 func (r *Room) Notify(ctx context.Context, peer *Participant, event string) {
+	r.NotifyStream(ctx, peer, event, "")
+}
+
+// NotifyStream notifies about an event of one of the streams of peer.
+func (r *Room) NotifyStream(ctx context.Context, peer *Participant, event string, stream string) {
+	r.notifyAll(ctx, Event{Event: event, Peer: peer, Stream: stream})
+}
+
+// notifyAll notifies the local participants and the other instances about
+// the event of e.Peer.
+func (r *Room) notifyAll(ctx context.Context, e Event) {
+	r.notify(ctx, e.Peer, e.Event, e.Stream)
+
+	var invitedParticipants []*InvitedParticipant
+	var hands []RaisedHand
+	var startedAt *int64
+	var initiatorID int64
+	func() {
+		r.Lock.RLock()
+		defer r.Lock.RUnlock()
+		invitedParticipants = append(invitedParticipants, r.InvitedParticipants...)
+		hands = append([]RaisedHand{}, r.RaisedHands...)
+		startedAt = r.StartedAt
+		initiatorID = r.InitiatorID
+	}()
+
+	e.Kind = NotifyKind
+	e.InvitedParticipants = invitedParticipants
+	e.Hands = hands
+	e.StartedAt = startedAt
+	e.InitiatorID = initiatorID
+
+	r.publish(ctx, e)
+}
+
+func (r *Room) notify(ctx context.Context, peer *Participant, event string, stream string) {
 	var participants []*Participant
 	var invitedParticipants []*InvitedParticipant
+	var hands []RaisedHand
 	func() {
 		r.Lock.RLock()
 		defer r.Lock.RUnlock()
 		participants = append(participants, r.Participants...)
 		invitedParticipants = append(invitedParticipants, r.InvitedParticipants...)
+		hands = append([]RaisedHand{}, r.RaisedHands...)
 	}()
 
 	logger.Tf(ctx, "Count participants: %d, peerId: %d", len(participants), peer.UserID)
@@ -273,6 +600,8 @@ func (r *Room) Notify(ctx context.Context, peer *Participant, event string) {
 				Participants:        participants,
 				InvitedParticipants: invitedParticipants,
 				StartedAt:           r.StartedAt,
+				Hands:               hands,
+				Stream:              stream,
 			},
 		}
 
@@ -283,30 +612,136 @@ func (r *Room) Notify(ctx context.Context, peer *Participant, event string) {
 			return
 		}
 
-		select {
-		case <-ctx.Done():
-			return
-		case participant.Out <- message:
-		}
+		participant.Send(message)
+	}
+}
+
+// ChooseMode sets the media mode of a room that has none yet, SFUMode if
+// mode is empty, and returns the mode of the room.
+func (r *Room) ChooseMode(ctx context.Context, mode string) string {
+	if mode == "" {
+		mode = SFUMode
+	}
+
+	r.Lock.Lock()
+	if r.Mode != "" {
+		actual := r.Mode
+		r.Lock.Unlock()
+		return actual
+	}
+	r.Mode = mode
+	r.Lock.Unlock()
+
+	r.publish(ctx, Event{
+		Kind: ModeKind,
+		Mode: mode,
+	})
+
+	return mode
+}
+
+// IsP2P reports whether the participants negotiate the media directly.
+func (r *Room) IsP2P() bool {
+	r.Lock.RLock()
+	defer r.Lock.RUnlock()
+
+	return r.Mode == P2PMode
+}
+
+// Relay delivers an offer, answer or ICE candidate of one participant to
+// another one, wherever the target is connected.
+func (r *Room) Relay(ctx context.Context, from int64, to int64, event string, sdp string, candidate json.RawMessage) error {
+	target, err := r.Get(to)
+	if err != nil {
+		return err
+	}
+
+	if !target.IsRemote() {
+		r.relay(ctx, target, from, event, sdp, candidate)
+		return nil
 	}
+
+	r.publish(ctx, Event{
+		Kind:         RelayKind,
+		Event:        event,
+		UserID:       from,
+		TargetUserID: to,
+		SDP:          sdp,
+		Candidate:    candidate,
+	})
+
+	return nil
 }
 
-func (r *Room) NotifySpeak(ctx context.Context, userID int64, level float64, event string) {
+func (r *Room) relay(
+	ctx context.Context,
+	target *Participant,
+	from int64,
+	event string,
+	sdp string,
+	candidate json.RawMessage,
+) {
+	response := NotifyRelayResponse{
+		NotifyRelayMessage{
+			Action:    "notify",
+			Event:     event,
+			UserID:    from,
+			SDP:       sdp,
+			Candidate: candidate,
+		},
+	}
+
+	message, err := json.Marshal(response)
+	if err != nil {
+		return
+	}
+
+	target.Send(message)
+}
+
+// End terminates the call for everyone: participants and ringing devices
+// receive callEnded and the participants leave the room.
+func (r *Room) End(ctx context.Context, userID int64, reason string) {
+	r.end(ctx, userID, reason)
+
+	r.publish(ctx, Event{
+		Kind:   EndKind,
+		Event:  CallEndedEvent,
+		UserID: userID,
+		Reason: reason,
+	})
+}
+
+func (r *Room) end(ctx context.Context, userID int64, reason string) {
 	var participants []*Participant
-	var invitedParticipants []*InvitedParticipant
+	var devices []*Device
+	var startedAt *int64
 	func() {
-		r.Lock.RLock()
-		defer r.Lock.RUnlock()
-		participants = append(participants, r.Participants...)
-		invitedParticipants = append(invitedParticipants, r.InvitedParticipants...)
+		r.Lock.Lock()
+		defer r.Lock.Unlock()
+		participants = r.Participants
+		devices = r.devices()
+		startedAt = r.StartedAt
+		r.Participants = nil
+		r.InvitedParticipants = nil
+		r.RaisedHands = nil
+		endedAt := time.Now().Unix()
+		r.EndedAt = &endedAt
 	}()
 
-	response := NotifySpeakResponse{
-		NotifySpeakMessage{
-			Action: "notify",
-			Event:  event,
-			UserID: userID,
-			Level:  level,
+	var duration int64
+	if startedAt != nil {
+		duration = time.Now().Unix() - *startedAt
+	}
+
+	response := NotifyCallEndedResponse{
+		NotifyCallEndedMessage{
+			Action:    "notify",
+			Event:     CallEndedEvent,
+			UserID:    userID,
+			Reason:    reason,
+			StartedAt: startedAt,
+			Duration:  duration,
 		},
 	}
 
@@ -315,15 +750,14 @@ func (r *Room) NotifySpeak(ctx context.Context, userID int64, level float64, eve
 		return
 	}
 
+	logger.Tf(ctx, "End %v by %d: %s", r, userID, reason)
+
 	for _, participant := range participants {
-		if participant.UserID == userID {
-			continue
-		}
+		participant.Send(message)
+		participant.Leave()
+	}
 
-		select {
-		case <-ctx.Done():
-			return
-		case participant.Out <- message:
-		}
+	for _, device := range devices {
+		device.Send(message)
 	}
 }
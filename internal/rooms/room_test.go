@@ -0,0 +1,95 @@
+package rooms
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoomEnd(t *testing.T) {
+	ctx := context.Background()
+	r := &Room{Name: "call"}
+
+	var participants []*Participant
+	for userID := int64(1); userID <= 2; userID++ {
+		participantCtx, cancel := context.WithCancel(ctx)
+		p := &Participant{Room: r, Out: NewQueue(QueueConfig{}, nil), Cancel: cancel, UserID: userID}
+		require.NoError(t, r.Add(p))
+
+		emptyRooms := make(chan string, 1)
+		go p.HandleContextDone(participantCtx, emptyRooms, 0)
+
+		participants = append(participants, p)
+	}
+
+	require.True(t, r.IsInitiator(1))
+	require.NotNil(t, r.StartedAt)
+
+	r.End(ctx, 1, HangupReason)
+
+	for _, p := range participants {
+		response := NotifyCallEndedResponse{}
+		require.NoError(t, json.Unmarshal(receive(t, p.Out), &response))
+		require.Equal(t, CallEndedEvent, response.Message.Event)
+		require.Equal(t, HangupReason, response.Message.Reason)
+		require.Equal(t, int64(1), response.Message.UserID)
+	}
+
+	require.True(t, r.IsEmpty())
+	require.False(t, r.Remove(participants[0]))
+}
+
+func TestRoomRelay(t *testing.T) {
+	ctx := context.Background()
+	r := &Room{Name: "call"}
+
+	require.Equal(t, P2PMode, r.ChooseMode(ctx, P2PMode))
+	require.Equal(t, P2PMode, r.ChooseMode(ctx, SFUMode))
+	require.True(t, r.IsP2P())
+
+	alice := &Participant{Room: r, Out: NewQueue(QueueConfig{}, nil), UserID: 1}
+	bob := &Participant{Room: r, Out: NewQueue(QueueConfig{}, nil), UserID: 2}
+	require.NoError(t, r.Add(alice))
+	require.NoError(t, r.Add(bob))
+
+	candidate := json.RawMessage(`{"candidate":"candidate:1","sdpMid":"0"}`)
+	require.NoError(t, r.Relay(ctx, alice.UserID, bob.UserID, "iceCandidate", "", candidate))
+
+	response := NotifyRelayResponse{}
+	require.NoError(t, json.Unmarshal(receive(t, bob.Out), &response))
+	require.Equal(t, "iceCandidate", response.Message.Event)
+	require.Equal(t, alice.UserID, response.Message.UserID)
+	require.JSONEq(t, string(candidate), string(response.Message.Candidate))
+	require.Zero(t, alice.Out.Len())
+
+	require.ErrorIs(t, r.Relay(ctx, alice.UserID, 3, "offer", "sdp", nil), ErrParticipantNotFound)
+}
+
+func TestRoomCapacityAndRoles(t *testing.T) {
+	r := &Room{Name: "call", Type: GroupType, MaxParticipants: 3}
+
+	host := &Participant{Room: r, UserID: 1}
+	require.NoError(t, r.Add(host))
+	require.Equal(t, HostRole, host.Role)
+	require.Nil(t, r.StartedAt)
+
+	member := &Participant{Room: r, UserID: 2}
+	require.NoError(t, r.Add(member))
+	require.Equal(t, MemberRole, member.Role)
+	require.NotNil(t, r.StartedAt)
+	startedAt := *r.StartedAt
+
+	viewer := &Participant{Room: r, UserID: 3, Role: ViewerRole}
+	require.NoError(t, r.Add(viewer))
+	require.Equal(t, ViewerRole, viewer.Role)
+
+	require.ErrorIs(t, r.Add(&Participant{Room: r, UserID: 4}), ErrRoomFull)
+	require.ErrorIs(t, r.Add(&Participant{Room: r, UserID: 2}), ErrParticipantExists)
+
+	// The call keeps its start time while people come and go.
+	require.True(t, r.Remove(member))
+	require.NoError(t, r.Add(&Participant{Room: r, UserID: 4}))
+	require.Equal(t, startedAt, *r.StartedAt)
+}
@@ -0,0 +1,314 @@
+package rooms
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	ActiveSpeakerEvent string = "activeSpeaker"
+	LevelsEvent        string = "levels"
+
+	// speakersTick is how often the active speaker is evaluated.
+	speakersTick = 200 * time.Millisecond
+)
+
+// SpeakerConfig tunes the active speaker detection.
+type SpeakerConfig struct {
+	// Window is how long the levels are averaged over.
+	Window time.Duration
+	// Threshold is the lowest average level of an active speaker.
+	Threshold float64
+	// Ratio is how much louder than the active speaker another participant
+	// has to be to take over.
+	Ratio float64
+	// Hold is the shortest time a participant stays the active speaker.
+	Hold time.Duration
+	// LevelsInterval is the period of the batched levels message.
+	LevelsInterval time.Duration
+}
+
+type SpeakerLevel struct {
+	UserID int64   `json:"userId"`
+	Level  float64 `json:"level"`
+}
+
+type speakerSample struct {
+	at    time.Time
+	level float64
+}
+
+type speakersUpdate struct {
+	active  int64
+	level   float64
+	changed bool
+	levels  []SpeakerLevel
+	idle    bool
+}
+
+// speakers aggregates the audio levels of a room, it runs while levels
+// keep coming.
+type speakers struct {
+	config SpeakerConfig
+
+	mu         sync.Mutex
+	samples    map[int64][]speakerSample
+	active     int64
+	switchedAt time.Time
+	levelsAt   time.Time
+	running    bool
+
+	// unshared are the levels of the local participants since the last
+	// tick, the other instances only get their average.
+	unshared map[int64][]float64
+}
+
+func newSpeakers(config SpeakerConfig) *speakers {
+	if config.Window <= 0 {
+		config.Window = 1500 * time.Millisecond
+	}
+	if config.Threshold <= 0 {
+		config.Threshold = 0.05
+	}
+	if config.Ratio < 1 {
+		config.Ratio = 1.5
+	}
+	if config.Hold <= 0 {
+		config.Hold = time.Second
+	}
+	if config.LevelsInterval <= 0 {
+		config.LevelsInterval = time.Second
+	}
+
+	return &speakers{
+		config:  config,
+		samples: make(map[int64][]speakerSample),
+	}
+}
+
+// add records a level, it reports whether the detection has to be started.
+func (s *speakers) add(userID int64, level float64, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.samples[userID] = append(s.samples[userID], speakerSample{at: now, level: level})
+
+	if s.running {
+		return false
+	}
+	s.running = true
+
+	return true
+}
+
+// share keeps a level of a local participant for the other instances.
+func (s *speakers) share(userID int64, level float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.unshared == nil {
+		s.unshared = make(map[int64][]float64)
+	}
+	s.unshared[userID] = append(s.unshared[userID], level)
+}
+
+// takeUnshared returns the average level of every local participant since
+// the last call.
+func (s *speakers) takeUnshared() []SpeakerLevel {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	levels := make([]SpeakerLevel, 0, len(s.unshared))
+	for userID, samples := range s.unshared {
+		sum := 0.0
+		for _, level := range samples {
+			sum += level
+		}
+		levels = append(levels, SpeakerLevel{UserID: userID, Level: sum / float64(len(samples))})
+	}
+	sort.Slice(levels, func(i, j int) bool {
+		return levels[i].UserID < levels[j].UserID
+	})
+	s.unshared = nil
+
+	return levels
+}
+
+// update drops the levels out of the window and elects the active speaker.
+// The detection is idle once there are no levels left.
+func (s *speakers) update(now time.Time) speakersUpdate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	averages := make(map[int64]float64, len(s.samples))
+	for userID, samples := range s.samples {
+		first := 0
+		for first < len(samples) && now.Sub(samples[first].at) > s.config.Window {
+			first++
+		}
+		samples = samples[first:]
+
+		if len(samples) == 0 {
+			delete(s.samples, userID)
+			continue
+		}
+		s.samples[userID] = samples
+
+		sum := 0.0
+		for _, sample := range samples {
+			sum += sample.level
+		}
+		averages[userID] = sum / float64(len(samples))
+	}
+
+	update := speakersUpdate{active: s.active}
+
+	var candidate int64
+	for userID, average := range averages {
+		if average >= s.config.Threshold && (candidate == 0 || average > averages[candidate]) {
+			candidate = userID
+		}
+	}
+
+	// The active speaker is kept for Hold and until someone is clearly louder.
+	if candidate != 0 && candidate != s.active &&
+		(s.active == 0 || (now.Sub(s.switchedAt) >= s.config.Hold &&
+			averages[candidate] >= averages[s.active]*s.config.Ratio)) {
+		s.active = candidate
+		s.switchedAt = now
+		update.active = candidate
+		update.level = averages[candidate]
+		update.changed = true
+	}
+
+	if len(averages) > 0 && now.Sub(s.levelsAt) >= s.config.LevelsInterval {
+		s.levelsAt = now
+		for userID, average := range averages {
+			update.levels = append(update.levels, SpeakerLevel{UserID: userID, Level: average})
+		}
+		sort.Slice(update.levels, func(i, j int) bool {
+			return update.levels[i].UserID < update.levels[j].UserID
+		})
+	}
+
+	if len(s.samples) == 0 {
+		s.running = false
+		update.idle = true
+	}
+
+	return update
+}
+
+func (s *speakers) activeSpeaker() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.active
+}
+
+// Speak records an audio level of a participant. The participants are told
+// about the active speaker when it changes and get the levels in batches.
+func (r *Room) Speak(_ context.Context, userID int64, level float64) {
+	r.speak(userID, level, true)
+}
+
+// ActiveSpeaker returns the elected active speaker, it changes with the
+// averaged levels rather than with every sample. 0 before anyone spoke.
+func (r *Room) ActiveSpeaker() int64 {
+	r.Lock.RLock()
+	s := r.speakers
+	r.Lock.RUnlock()
+
+	if s == nil {
+		return 0
+	}
+
+	return s.activeSpeaker()
+}
+
+func (r *Room) speak(userID int64, level float64, local bool) {
+	r.Lock.Lock()
+	if r.speakers == nil {
+		r.speakers = newSpeakers(r.SpeakerConfig)
+	}
+	s := r.speakers
+	r.Lock.Unlock()
+
+	if local {
+		s.share(userID, level)
+	}
+	if s.add(userID, level, time.Now()) {
+		go r.detectSpeakers(s)
+	}
+}
+
+func (r *Room) detectSpeakers(s *speakers) {
+	ticker := time.NewTicker(speakersTick)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		// The other instances get a level per speaker and tick, not every
+		// sample.
+		for _, level := range s.takeUnshared() {
+			r.publish(context.Background(), Event{
+				Kind:   SpeakKind,
+				UserID: level.UserID,
+				Level:  level.Level,
+			})
+		}
+
+		update := s.update(now)
+
+		if update.changed {
+			r.notifySpeakers(NotifyActiveSpeakerResponse{
+				NotifyActiveSpeakerMessage{
+					Action: "notify",
+					Event:  ActiveSpeakerEvent,
+					UserID: update.active,
+					Level:  update.level,
+				},
+			}, "")
+		}
+
+		if len(update.levels) > 0 {
+			r.notifySpeakers(NotifyLevelsResponse{
+				NotifyLevelsMessage{
+					Action: "notify",
+					Event:  LevelsEvent,
+					Levels: update.levels,
+				},
+			}, LevelsEvent)
+		}
+
+		if update.idle {
+			return
+		}
+	}
+}
+
+// notifySpeakers sends the response to the local participants, coalesced
+// by key unless it is empty.
+func (r *Room) notifySpeakers(response any, key string) {
+	var participants []*Participant
+	func() {
+		r.Lock.RLock()
+		defer r.Lock.RUnlock()
+		participants = append(participants, r.Participants...)
+	}()
+
+	message, err := json.Marshal(response)
+	if err != nil {
+		return
+	}
+
+	for _, participant := range participants {
+		if key == "" {
+			participant.Send(message)
+		} else {
+			participant.SendLatest(key, message)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package rooms
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpeakers(t *testing.T) {
+	s := newSpeakers(SpeakerConfig{
+		Window:         time.Second,
+		Threshold:      0.1,
+		Ratio:          2,
+		Hold:           time.Second,
+		LevelsInterval: 500 * time.Millisecond,
+	})
+	start := time.Unix(1700000000, 0)
+
+	require.True(t, s.add(1, 0.05, start))
+	require.False(t, s.add(2, 0.3, start))
+
+	update := s.update(start)
+	require.True(t, update.changed)
+	require.Equal(t, int64(2), update.active)
+	require.Equal(t, []SpeakerLevel{{UserID: 1, Level: 0.05}, {UserID: 2, Level: 0.3}}, update.levels)
+
+	// Louder, but within Hold.
+	s.add(1, 0.9, start.Add(100*time.Millisecond))
+	update = s.update(start.Add(200 * time.Millisecond))
+	require.False(t, update.changed)
+	require.Empty(t, update.levels)
+
+	// Louder than the active speaker but not by Ratio.
+	s.add(2, 0.3, start.Add(1200*time.Millisecond))
+	s.add(1, 0.5, start.Add(1200*time.Millisecond))
+	update = s.update(start.Add(1200 * time.Millisecond))
+	require.False(t, update.changed)
+	require.Len(t, update.levels, 2)
+
+	s.add(1, 0.55, start.Add(1300*time.Millisecond))
+	update = s.update(start.Add(1300 * time.Millisecond))
+	require.False(t, update.changed)
+
+	s.add(1, 0.9, start.Add(1400*time.Millisecond))
+	s.add(1, 0.9, start.Add(1500*time.Millisecond))
+	update = s.update(start.Add(1500 * time.Millisecond))
+	require.True(t, update.changed)
+	require.Equal(t, int64(1), update.active)
+
+	update = s.update(start.Add(3 * time.Second))
+	require.True(t, update.idle)
+	require.Equal(t, int64(1), s.activeSpeaker())
+	require.True(t, s.add(2, 0.3, start.Add(3*time.Second)))
+}
+
+type speakObserver struct {
+	mu     sync.Mutex
+	levels []SpeakerLevel
+}
+
+func (o *speakObserver) Observe(_ context.Context, e Event) {
+	if e.Kind != SpeakKind {
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.levels = append(o.levels, SpeakerLevel{UserID: e.UserID, Level: e.Level})
+}
+
+func (o *speakObserver) shared() []SpeakerLevel {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]SpeakerLevel(nil), o.levels...)
+}
+
+func TestRoomSpeakShared(t *testing.T) {
+	ctx := context.Background()
+	observer := &speakObserver{}
+	r := &Room{Name: "call", Observer: observer}
+
+	for i := 0; i < 10; i++ {
+		r.Speak(ctx, 1, 0.5)
+	}
+	r.Speak(ctx, 2, 0.1)
+	r.Speak(ctx, 2, 0.3)
+
+	// Levels of other instances are not shared again.
+	r.Apply(ctx, Event{Kind: SpeakKind, UserID: 3, Level: 0.9})
+
+	require.Eventually(t, func() bool {
+		return len(observer.shared()) == 2
+	}, time.Second, 10*time.Millisecond)
+	levels := observer.shared()
+	require.Equal(t, int64(1), levels[0].UserID)
+	require.InDelta(t, 0.5, levels[0].Level, 1e-9)
+	require.Equal(t, int64(2), levels[1].UserID)
+	require.InDelta(t, 0.2, levels[1].Level, 1e-9)
+
+	time.Sleep(2 * speakersTick)
+	require.Len(t, observer.shared(), 2)
+}
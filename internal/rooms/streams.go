@@ -0,0 +1,206 @@
+package rooms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// CameraStream is the stream of a participant's camera and microphone,
+	// the one published when no kind is given.
+	CameraStream string = "camera"
+	// ScreenStream is a shared screen, see Room.MaxScreenShares.
+	ScreenStream string = "screen"
+
+	// StreamEndedEvent tells the viewers to stop playing a stream.
+	StreamEndedEvent string = "streamEnded"
+)
+
+var (
+	ErrUnknownStream = errors.New("unknown stream kind")
+	ErrStreamLimit   = errors.New("too many streams of this kind")
+)
+
+// streamKinds are the kinds of stream a participant may publish.
+var streamKinds = map[string]bool{
+	CameraStream: true,
+	ScreenStream: true,
+}
+
+// Stream is a stream a participant publishes.
+type Stream struct {
+	PublishedAt int64 `json:"publishedAt"`
+	// MediaServer is the node the stream is played from.
+	MediaServer string `json:"mediaServer,omitempty"`
+}
+
+// StreamSession is the session of a published stream on a media server.
+type StreamSession struct {
+	MediaServer string
+	ID          string
+}
+
+// StreamKind returns the kind of stream, CameraStream if it is empty.
+func StreamKind(kind string) (string, error) {
+	if kind == "" {
+		return CameraStream, nil
+	}
+
+	if !streamKinds[kind] {
+		return "", fmt.Errorf("%w: %q", ErrUnknownStream, kind)
+	}
+
+	return kind, nil
+}
+
+// CanPublish tells whether the participant may publish a stream of the
+// kind now.
+func (r *Room) CanPublish(p *Participant, kind string) error {
+	r.Lock.RLock()
+	defer r.Lock.RUnlock()
+
+	return r.canPublish(p, kind)
+}
+
+// canPublish requires the room lock held.
+func (r *Room) canPublish(p *Participant, kind string) error {
+	if kind != ScreenStream || r.MaxScreenShares <= 0 {
+		return nil
+	}
+
+	if _, ok := p.Streams[kind]; ok {
+		return nil
+	}
+
+	shares := 0
+	for _, participant := range r.Participants {
+		if _, ok := participant.Streams[kind]; ok {
+			shares++
+		}
+	}
+
+	if shares >= r.MaxScreenShares {
+		return fmt.Errorf("%w: %v shares %d screens", ErrStreamLimit, r.Name, shares)
+	}
+
+	return nil
+}
+
+// Publish marks the stream of the participant as published, it reports
+// false if it already was.
+func (r *Room) Publish(p *Participant, kind string) (bool, error) {
+	r.Lock.Lock()
+	defer r.Lock.Unlock()
+
+	if _, ok := p.Streams[kind]; ok {
+		return false, nil
+	}
+
+	if err := r.canPublish(p, kind); err != nil {
+		return false, err
+	}
+
+	// The map is replaced, never changed, as notifications marshal it
+	// without the lock.
+	streams := make(map[string]Stream, len(p.Streams)+1)
+	for k, stream := range p.Streams {
+		streams[k] = stream
+	}
+	streams[kind] = Stream{PublishedAt: time.Now().Unix(), MediaServer: p.sessions[kind].MediaServer}
+	p.Streams = streams
+
+	return true, nil
+}
+
+// StreamMediaServer returns the node the stream of the participant was
+// published to, empty if it is not known.
+func (r *Room) StreamMediaServer(userID int64, kind string) string {
+	if kind == "" {
+		kind = CameraStream
+	}
+
+	r.Lock.RLock()
+	defer r.Lock.RUnlock()
+
+	for _, p := range r.Participants {
+		if p.UserID == userID {
+			return p.Streams[kind].MediaServer
+		}
+	}
+
+	return ""
+}
+
+// SetSession keeps the media server session negotiated for the stream of
+// the participant, it is stopped when the stream is unpublished.
+func (r *Room) SetSession(p *Participant, kind string, session StreamSession) {
+	r.Lock.Lock()
+	defer r.Lock.Unlock()
+
+	if p.sessions == nil {
+		p.sessions = map[string]StreamSession{}
+	}
+	p.sessions[kind] = session
+}
+
+// Unpublish ends the stream of the participant, it reports false if the
+// stream was neither published nor negotiated.
+func (r *Room) Unpublish(ctx context.Context, p *Participant, kind string) bool {
+	r.Lock.Lock()
+	session, ended := r.unpublish(p, kind)
+	r.Lock.Unlock()
+
+	if ended {
+		r.notifyAll(ctx, Event{Event: StreamEndedEvent, Peer: p, Stream: kind, Session: session})
+	}
+
+	return ended
+}
+
+// UnpublishAll ends every stream of the participant.
+func (r *Room) UnpublishAll(ctx context.Context, p *Participant) {
+	var kinds []string
+	func() {
+		r.Lock.RLock()
+		defer r.Lock.RUnlock()
+
+		for kind := range p.Streams {
+			kinds = append(kinds, kind)
+		}
+		for kind := range p.sessions {
+			if _, ok := p.Streams[kind]; !ok {
+				kinds = append(kinds, kind)
+			}
+		}
+	}()
+
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		r.Unpublish(ctx, p, kind)
+	}
+}
+
+// unpublish requires the room lock held.
+func (r *Room) unpublish(p *Participant, kind string) (*StreamSession, bool) {
+	var session *StreamSession
+	if s, ok := p.sessions[kind]; ok {
+		session = &s
+		delete(p.sessions, kind)
+	}
+
+	_, published := p.Streams[kind]
+	if published {
+		streams := make(map[string]Stream, len(p.Streams))
+		for k, stream := range p.Streams {
+			if k != kind {
+				streams[k] = stream
+			}
+		}
+		p.Streams = streams
+	}
+
+	return session, published || session != nil
+}
@@ -0,0 +1,113 @@
+package rooms
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoomStreams(t *testing.T) {
+	r := &Room{Name: "call", Type: GroupType, MaxScreenShares: 1}
+
+	alice := &Participant{Room: r, Out: NewQueue(QueueConfig{}, nil), UserID: 1}
+	bob := &Participant{Room: r, Out: NewQueue(QueueConfig{}, nil), UserID: 2}
+	require.NoError(t, r.Add(alice))
+	require.NoError(t, r.Add(bob))
+
+	kind, err := StreamKind("")
+	require.NoError(t, err)
+	require.Equal(t, CameraStream, kind)
+
+	_, err = StreamKind("whiteboard")
+	require.ErrorIs(t, err, ErrUnknownStream)
+
+	// Everyone may publish a camera.
+	for _, p := range []*Participant{alice, bob} {
+		published, err := r.Publish(p, CameraStream)
+		require.NoError(t, err)
+		require.True(t, published)
+	}
+
+	published, err := r.Publish(alice, ScreenStream)
+	require.NoError(t, err)
+	require.True(t, published)
+	require.Contains(t, alice.Streams, CameraStream)
+	require.Contains(t, alice.Streams, ScreenStream)
+
+	// Publishing again is not a change.
+	published, err = r.Publish(alice, ScreenStream)
+	require.NoError(t, err)
+	require.False(t, published)
+	require.NoError(t, r.CanPublish(alice, ScreenStream))
+
+	require.ErrorIs(t, r.CanPublish(bob, ScreenStream), ErrStreamLimit)
+	_, err = r.Publish(bob, ScreenStream)
+	require.ErrorIs(t, err, ErrStreamLimit)
+	require.NotContains(t, bob.Streams, ScreenStream)
+
+	r.MaxScreenShares = 0
+	published, err = r.Publish(bob, ScreenStream)
+	require.NoError(t, err)
+	require.True(t, published)
+}
+
+type sessionObserver struct {
+	mu       sync.Mutex
+	sessions []StreamSession
+}
+
+func (o *sessionObserver) Observe(_ context.Context, e Event) {
+	if e.Event != StreamEndedEvent || e.Session == nil {
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.sessions = append(o.sessions, *e.Session)
+}
+
+func TestRoomUnpublish(t *testing.T) {
+	observer := &sessionObserver{}
+	r := &Room{Name: "call", Type: GroupType, Observer: observer}
+
+	alice := &Participant{Room: r, Out: NewQueue(QueueConfig{}, nil), UserID: 1}
+	require.NoError(t, r.Add(alice))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	bob := &Participant{Room: r, Out: NewQueue(QueueConfig{}, nil), Cancel: cancel, UserID: 2}
+	require.NoError(t, r.Add(bob))
+
+	for _, kind := range []string{CameraStream, ScreenStream} {
+		r.SetSession(bob, kind, StreamSession{MediaServer: "srs", ID: "bob-" + kind})
+		_, err := r.Publish(bob, kind)
+		require.NoError(t, err)
+	}
+
+	require.True(t, r.Unpublish(context.Background(), bob, ScreenStream))
+	require.False(t, r.Unpublish(context.Background(), bob, ScreenStream))
+	require.NotContains(t, bob.Streams, ScreenStream)
+
+	response := NotifyResponse{}
+	require.NoError(t, json.Unmarshal(receive(t, alice.Out), &response))
+	require.Equal(t, StreamEndedEvent, response.Message.Event)
+	require.Equal(t, ScreenStream, response.Message.Stream)
+	require.Equal(t, bob.UserID, response.Message.Peer.UserID)
+
+	// The camera is unpublished when bob leaves.
+	emptyRooms := make(chan string, 1)
+	go bob.HandleContextDone(ctx, emptyRooms, 0)
+	cancel()
+
+	for _, event := range []string{StreamEndedEvent, "leave"} {
+		response := NotifyResponse{}
+		require.NoError(t, json.Unmarshal(receive(t, alice.Out), &response))
+		require.Equal(t, event, response.Message.Event)
+	}
+
+	observer.mu.Lock()
+	defer observer.mu.Unlock()
+	require.Equal(t, []StreamSession{{MediaServer: "srs", ID: "bob-screen"}, {MediaServer: "srs", ID: "bob-camera"}}, observer.sessions)
+}
@@ -0,0 +1,147 @@
+package internalhttp
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func adminAuth(token string) mux.MiddlewareFunc {
+	expected := []byte("Bearer " + token)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+				http.Error(w, "401 Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (s *handler) AdminRooms(w http.ResponseWriter, r *http.Request) {
+	response, err := s.app.AdminRooms(r.Context())
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("AdminRooms - error: %s", err))
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	s.writeJSON(w, "AdminRooms", response)
+}
+
+func (s *handler) AdminRoom(w http.ResponseWriter, r *http.Request) {
+	response, found, err := s.app.AdminRoom(r.Context(), mux.Vars(r)["room"])
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("AdminRoom - error: %s", err))
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if !found {
+		methodNotFoundHandler(w, r)
+		return
+	}
+
+	s.writeJSON(w, "AdminRoom", response)
+}
+
+func (s *handler) AdminKick(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	userID, err := strconv.ParseInt(vars["userId"], 10, 64)
+	if err != nil {
+		http.Error(w, "400 Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	if !s.app.AdminKick(r.Context(), vars["room"], userID) {
+		methodNotFoundHandler(w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *handler) AdminCloseRoom(w http.ResponseWriter, r *http.Request) {
+	if !s.app.AdminCloseRoom(r.Context(), mux.Vars(r)["room"]) {
+		methodNotFoundHandler(w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *handler) AdminWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	response, err := s.app.AdminWebhookDeliveries(r.Context())
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("AdminWebhookDeliveries - error: %s", err))
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	s.writeJSON(w, "AdminWebhookDeliveries", response)
+}
+
+// AdminCallHistory answers GET /calls?userId=&from=&to=&limit=&format=,
+// from and to are RFC 3339 times and format is json or csv.
+func (s *handler) AdminCallHistory(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	var userID int64
+	var from, to time.Time
+	var limit int
+	var err error
+	if value := params.Get("userId"); value != "" {
+		userID, err = strconv.ParseInt(value, 10, 64)
+	}
+	if value := params.Get("from"); value != "" && err == nil {
+		from, err = time.Parse(time.RFC3339, value)
+	}
+	if value := params.Get("to"); value != "" && err == nil {
+		to, err = time.Parse(time.RFC3339, value)
+	}
+	if value := params.Get("limit"); value != "" && err == nil {
+		limit, err = strconv.Atoi(value)
+	}
+
+	format := params.Get("format")
+	if err != nil || (format != "" && format != "json" && format != "csv") {
+		http.Error(w, "400 Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	response, err := s.app.AdminCallHistory(r.Context(), userID, from, to, limit, format)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("AdminCallHistory - error: %s", err))
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if format != "csv" {
+		s.writeJSON(w, "AdminCallHistory", response)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="calls.csv"`)
+
+	if _, err := w.Write(response); err != nil {
+		s.logger.Error(fmt.Sprintf("AdminCallHistory - response error: %s", err))
+	}
+}
+
+func (s *handler) writeJSON(w http.ResponseWriter, name string, response []byte) {
+	w.Header().Set("Content-Type", "application/json")
+
+	_, err := w.Write(response)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("%s - response error: %s", name, err))
+	}
+}
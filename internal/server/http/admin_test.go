@@ -0,0 +1,100 @@
+package internalhttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeApp struct {
+	kicked []int64
+}
+
+func (a *fakeApp) Health(_ context.Context) []byte         { return []byte("OK") }
+func (a *fakeApp) Version(_ context.Context) []byte        { return []byte("test") }
+func (a *fakeApp) WS(_ context.Context, _ *websocket.Conn) {}
+
+func (a *fakeApp) AdminRooms(_ context.Context) ([]byte, error) {
+	return []byte(`[{"name":"call"}]`), nil
+}
+
+func (a *fakeApp) AdminRoom(_ context.Context, name string) ([]byte, bool, error) {
+	if name != "call" {
+		return nil, false, nil
+	}
+	return []byte(`{"name":"call"}`), true, nil
+}
+
+func (a *fakeApp) AdminKick(_ context.Context, room string, userID int64) bool {
+	if room != "call" {
+		return false
+	}
+	a.kicked = append(a.kicked, userID)
+	return true
+}
+
+func (a *fakeApp) AdminCloseRoom(_ context.Context, room string) bool {
+	return room == "call"
+}
+
+func (a *fakeApp) AdminWebhookDeliveries(_ context.Context) ([]byte, error) {
+	return []byte(`[]`), nil
+}
+
+func (a *fakeApp) AdminCallHistory(_ context.Context, _ int64, _, _ time.Time, _ int, _ string) ([]byte, error) {
+	return []byte(`[]`), nil
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(_ string) {}
+func (nopLogger) Info(_ string)  {}
+func (nopLogger) Warn(_ string)  {}
+func (nopLogger) Error(_ string) {}
+
+func TestAdminHandlers(t *testing.T) {
+	app := &fakeApp{}
+	h := NewHandler(nopLogger{}, app, nil, "secret")
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		token  string
+		status int
+	}{
+		{"No token", http.MethodGet, "/admin/v1/rooms", "", http.StatusUnauthorized},
+		{"Wrong token", http.MethodGet, "/admin/v1/rooms", "other", http.StatusUnauthorized},
+		{"List rooms", http.MethodGet, "/admin/v1/rooms", "secret", http.StatusOK},
+		{"Get room", http.MethodGet, "/admin/v1/rooms/call", "secret", http.StatusOK},
+		{"Get missing room", http.MethodGet, "/admin/v1/rooms/other", "secret", http.StatusNotFound},
+		{"Kick", http.MethodDelete, "/admin/v1/rooms/call/participants/7", "secret", http.StatusNoContent},
+		{"Kick bad user", http.MethodDelete, "/admin/v1/rooms/call/participants/x", "secret", http.StatusBadRequest},
+		{"Close room", http.MethodDelete, "/admin/v1/rooms/call", "secret", http.StatusNoContent},
+		{"Close missing room", http.MethodDelete, "/admin/v1/rooms/other", "secret", http.StatusNotFound},
+		{"Call history", http.MethodGet, "/admin/v1/calls?userId=7&from=2024-01-01T00:00:00Z&format=csv", "secret", http.StatusOK},
+		{"Call history bad time", http.MethodGet, "/admin/v1/calls?from=yesterday", "secret", http.StatusBadRequest},
+		{"Call history bad format", http.MethodGet, "/admin/v1/calls?format=xml", "secret", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			require.Equal(t, tt.status, w.Code)
+		})
+	}
+
+	require.Equal(t, []int64{7}, app.kicked)
+}
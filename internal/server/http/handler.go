@@ -22,7 +22,7 @@ var wsUpgrader = websocket.Upgrader{
 	},
 }
 
-func NewHandler(logger Logger, app Application) http.Handler {
+func NewHandler(logger Logger, app Application, metrics http.Handler, adminToken string) http.Handler {
 	h := &handler{
 		logger: logger,
 		app:    app,
@@ -32,6 +32,19 @@ func NewHandler(logger Logger, app Application) http.Handler {
 	r.HandleFunc("/health", h.Health).Methods(http.MethodGet)
 	r.HandleFunc("/version", h.Version).Methods(http.MethodGet)
 	r.HandleFunc("/sig/v1/rtc", h.WS)
+	if metrics != nil {
+		r.Handle("/metrics", metrics).Methods(http.MethodGet)
+	}
+	if adminToken != "" {
+		admin := r.PathPrefix("/admin/v1").Subrouter()
+		admin.Use(adminAuth(adminToken))
+		admin.HandleFunc("/rooms", h.AdminRooms).Methods(http.MethodGet)
+		admin.HandleFunc("/rooms/{room}", h.AdminRoom).Methods(http.MethodGet)
+		admin.HandleFunc("/rooms/{room}", h.AdminCloseRoom).Methods(http.MethodDelete)
+		admin.HandleFunc("/rooms/{room}/participants/{userId}", h.AdminKick).Methods(http.MethodDelete)
+		admin.HandleFunc("/webhooks/deliveries", h.AdminWebhookDeliveries).Methods(http.MethodGet)
+		admin.HandleFunc("/calls", h.AdminCallHistory).Methods(http.MethodGet)
+	}
 	r.MethodNotAllowedHandler = http.HandlerFunc(methodNotAllowedHandler)
 	r.NotFoundHandler = http.HandlerFunc(methodNotFoundHandler)
 
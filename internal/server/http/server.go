@@ -26,12 +26,18 @@ type Application interface {
 	Health(ctx context.Context) []byte
 	Version(ctx context.Context) []byte
 	WS(ctx context.Context, conn *websocket.Conn)
+	AdminRooms(ctx context.Context) ([]byte, error)
+	AdminRoom(ctx context.Context, name string) ([]byte, bool, error)
+	AdminKick(ctx context.Context, room string, userID int64) bool
+	AdminCloseRoom(ctx context.Context, room string) bool
+	AdminWebhookDeliveries(ctx context.Context) ([]byte, error)
+	AdminCallHistory(ctx context.Context, userID int64, from, to time.Time, limit int, format string) ([]byte, error)
 }
 
-func New(logger Logger, app Application, host string, port int) *Server {
+func New(logger Logger, app Application, metrics http.Handler, adminToken string, host string, port int) *Server {
 	servers := &http.Server{
 		Addr:         net.JoinHostPort(host, strconv.Itoa(port)),
-		Handler:      NewHandler(logger, app),
+		Handler:      NewHandler(logger, app, metrics, adminToken),
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
 	}
@@ -0,0 +1,299 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ossrs/go-oryx-lib/logger"
+	internalrooms "signal/internal/rooms"
+)
+
+const (
+	CallStarted       string = "callStarted"
+	CallEnded         string = "callEnded"
+	ParticipantJoined string = "participantJoined"
+	ParticipantLeft   string = "participantLeft"
+	DeviceAccepted    string = "deviceAccepted"
+	DeviceDeclined    string = "deviceDeclined"
+	DeviceBusy        string = "deviceBusy"
+	RoomEmpty         string = "roomEmpty"
+
+	// maxDeliveries bounds the delivery log.
+	maxDeliveries = 200
+)
+
+type Config struct {
+	URLs        []string
+	Secret      string
+	QueueSize   int
+	MaxAttempts int
+	Backoff     time.Duration
+	Timeout     time.Duration
+}
+
+// Event is the JSON body posted to the webhook URLs.
+type Event struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	Room      string `json:"room"`
+	UserID    int64  `json:"userId,omitempty"`
+	DeviceID  string `json:"deviceId,omitempty"`
+	StartedAt *int64 `json:"startedAt,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// Delivery is one attempt to post an event to a URL.
+type Delivery struct {
+	EventID   string    `json:"eventId"`
+	Type      string    `json:"type"`
+	URL       string    `json:"url"`
+	Attempt   int       `json:"attempt"`
+	Status    int       `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Dispatcher posts signed room lifecycle events to the configured URLs.
+// Events are queued and delivered by a single worker, so the order is kept
+// and a slow endpoint never blocks the room notifications.
+type Dispatcher struct {
+	config Config
+	client *http.Client
+	queue  chan Event
+
+	mu         sync.Mutex
+	deliveries []Delivery
+	dropped    int
+}
+
+func New(config Config) *Dispatcher {
+	if config.QueueSize <= 0 {
+		config.QueueSize = 1000
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 5
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = time.Second
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 5 * time.Second
+	}
+
+	return &Dispatcher{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+		queue:  make(chan Event, config.QueueSize),
+	}
+}
+
+// Run delivers the queued events until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-d.queue:
+			for _, url := range d.config.URLs {
+				d.deliver(ctx, url, e)
+			}
+		}
+	}
+}
+
+// Observe turns room events into webhook events.
+func (d *Dispatcher) Observe(ctx context.Context, e internalrooms.Event) {
+	event := Event{
+		Room:      e.Room,
+		UserID:    e.UserID,
+		StartedAt: e.StartedAt,
+		Reason:    e.Reason,
+	}
+
+	switch {
+	case e.Kind == internalrooms.StartKind:
+		event.Type = CallStarted
+	case e.Kind == internalrooms.EndKind:
+		event.Type = CallEnded
+	case e.Kind == internalrooms.EmptyKind:
+		event.Type = RoomEmpty
+	case e.Kind == internalrooms.NotifyKind && e.Event == "join":
+		event.Type = ParticipantJoined
+		event.UserID = e.Peer.UserID
+	case e.Kind == internalrooms.NotifyKind && e.Event == "leave":
+		event.Type = ParticipantLeft
+		event.UserID = e.Peer.UserID
+	case e.Kind == internalrooms.PreconnectKind && e.Device != nil:
+		switch e.Event {
+		case internalrooms.AcceptStatus:
+			event.Type = DeviceAccepted
+		case internalrooms.DeclineStatus:
+			event.Type = DeviceDeclined
+		case internalrooms.BusyStatus:
+			event.Type = DeviceBusy
+		default:
+			return
+		}
+		event.UserID = e.Device.UserID
+		event.DeviceID = e.Device.ID
+	default:
+		return
+	}
+
+	d.Dispatch(ctx, event)
+}
+
+// Dispatch queues the event, it is dropped if the queue is full.
+func (d *Dispatcher) Dispatch(ctx context.Context, e Event) bool {
+	if e.ID == "" {
+		e.ID = newEventID()
+	}
+	if e.Timestamp == 0 {
+		e.Timestamp = time.Now().Unix()
+	}
+
+	select {
+	case d.queue <- e:
+		return true
+	default:
+		d.mu.Lock()
+		d.dropped++
+		d.mu.Unlock()
+
+		logger.Wf(ctx, "Webhook queue is full, drop %v event %v", e.Type, e.ID)
+		return false
+	}
+}
+
+// Deliveries returns the most recent delivery attempts, oldest first.
+func (d *Dispatcher) Deliveries() []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]Delivery(nil), d.deliveries...)
+}
+
+// Dropped returns the number of events lost because the queue was full.
+func (d *Dispatcher) Dropped() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.dropped
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, url string, e Event) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		logger.Wf(ctx, "Webhook marshal %v err %v", e.ID, err)
+		return
+	}
+
+	backoff := d.config.Backoff
+
+	for attempt := 1; attempt <= d.config.MaxAttempts; attempt++ {
+		status, err := d.post(ctx, url, e, body)
+		d.record(Delivery{
+			EventID:   e.ID,
+			Type:      e.Type,
+			URL:       url,
+			Attempt:   attempt,
+			Status:    status,
+			Error:     errorString(err),
+			Timestamp: time.Now(),
+		})
+
+		if err == nil {
+			return
+		}
+
+		logger.Wf(ctx, "Webhook %v %v to %v attempt %d err %v", e.Type, e.ID, url, attempt, err)
+
+		if attempt == d.config.MaxAttempts {
+			return
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		backoff *= 2
+	}
+}
+
+func (d *Dispatcher) post(ctx context.Context, url string, e Event, body []byte) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Signal-Event", e.Type)
+	req.Header.Set("X-Signal-Timestamp", timestamp)
+	if d.config.Secret != "" {
+		req.Header.Set("X-Signal-Signature", "sha256="+Sign(d.config.Secret, timestamp, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+func (d *Dispatcher) record(delivery Delivery) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.deliveries) == maxDeliveries {
+		d.deliveries = d.deliveries[1:]
+	}
+	d.deliveries = append(d.deliveries, delivery)
+}
+
+// Sign returns the hex HMAC-SHA256 of "timestamp.body", receivers compare
+// it with the X-Signal-Signature header.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newEventID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	return err.Error()
+}
@@ -0,0 +1,96 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	internalrooms "signal/internal/rooms"
+)
+
+func TestDispatcher(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var attempts atomic.Int32
+	received := make(chan Event, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		signature := Sign("secret", r.Header.Get("X-Signal-Timestamp"), body)
+		require.Equal(t, "sha256="+signature, r.Header.Get("X-Signal-Signature"))
+
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		e := Event{}
+		require.NoError(t, json.Unmarshal(body, &e))
+		received <- e
+	}))
+	defer server.Close()
+
+	d := New(Config{
+		URLs:    []string{server.URL},
+		Secret:  "secret",
+		Backoff: time.Millisecond,
+	})
+	go d.Run(ctx)
+
+	startedAt := time.Now().Unix()
+	d.Observe(ctx, internalrooms.Event{
+		Room:      "call",
+		Kind:      internalrooms.StartKind,
+		UserID:    2,
+		StartedAt: &startedAt,
+	})
+
+	select {
+	case e := <-received:
+		require.Equal(t, CallStarted, e.Type)
+		require.Equal(t, "call", e.Room)
+		require.Equal(t, int64(2), e.UserID)
+		require.NotEmpty(t, e.ID)
+	case <-time.After(time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+
+	require.Eventually(t, func() bool {
+		return len(d.Deliveries()) == 2
+	}, time.Second, time.Millisecond)
+
+	deliveries := d.Deliveries()
+	require.Equal(t, http.StatusServiceUnavailable, deliveries[0].Status)
+	require.NotEmpty(t, deliveries[0].Error)
+	require.Equal(t, 2, deliveries[1].Attempt)
+	require.Empty(t, deliveries[1].Error)
+}
+
+func TestDispatcherQueueFull(t *testing.T) {
+	d := New(Config{URLs: []string{"http://127.0.0.1:0"}, QueueSize: 1})
+
+	require.True(t, d.Dispatch(context.Background(), Event{Type: RoomEmpty, Room: "call"}))
+	require.False(t, d.Dispatch(context.Background(), Event{Type: RoomEmpty, Room: "call"}))
+	require.Equal(t, 1, d.Dropped())
+}
+
+func TestObserveIgnoresOtherEvents(t *testing.T) {
+	d := New(Config{QueueSize: 1})
+
+	d.Observe(context.Background(), internalrooms.Event{
+		Room:   "call",
+		Kind:   internalrooms.SpeakKind,
+		UserID: 1,
+	})
+
+	require.Empty(t, d.queue)
+}